@@ -3,12 +3,15 @@ package api
 import (
 	"log/slog"
 	"sync"
+	"sync/atomic"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	"github.com/ruhollahh/paperback/api/config"
+	"github.com/ruhollahh/paperback/api/metrics"
 	"github.com/ruhollahh/paperback/internal/app/service"
 	"github.com/ruhollahh/paperback/internal/mailer"
+	"github.com/ruhollahh/paperback/internal/oidc"
 )
 
 type API struct {
@@ -18,5 +21,9 @@ type API struct {
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
 	Mailer         mailer.Mailer
+	OIDC           oidc.Providers
 	Wg             sync.WaitGroup
+	Metrics        *metrics.Metrics
+
+	draining atomic.Bool
 }
@@ -1,21 +1,39 @@
 package config
 
 import (
+	"net/netip"
+	"time"
+
 	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/internal/oidc"
+	"github.com/ruhollahh/paperback/internal/tracing"
+	"github.com/ruhollahh/paperback/pkg/passwordhash"
+	"github.com/ruhollahh/paperback/pkg/passwordpolicy"
 )
 
 const Version = "1.0.0"
 
+type LimiterConfig struct {
+	Rps     float64
+	Burst   int
+	Enabled bool
+	// Login is the stricter limit applied to sign-in endpoints on top of
+	// the global one.
+	Login struct {
+		Rps   float64
+		Burst int
+	}
+}
+
 type Config struct {
 	Port    int
 	Env     string
 	Db      service.DBConfig
-	Limiter struct {
-		Rps     float64
-		Burst   int
-		Enabled bool
-	}
-	Smtp struct {
+	Limiter LimiterConfig
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header is
+	// believed when working out a client's IP.
+	TrustedProxies []netip.Prefix
+	Smtp           struct {
 		Host     string
 		Port     int
 		Username string
@@ -25,4 +43,30 @@ type Config struct {
 	Cors struct {
 		TrustedOrigins []string
 	}
+	TwoFactor     service.TwoFactorConfig
+	LoginThrottle service.LoginThrottleConfig
+	Oidc          struct {
+		Providers []oidc.ProviderConfig
+	}
+	Permissions struct {
+		CacheTTL time.Duration
+	}
+	PersonalAccessTokens struct {
+		MaxTTLDays int
+	}
+	PasswordPolicy passwordpolicy.Config
+	PasswordHash   passwordhash.Config
+	Tracing        tracing.Config
+	Health         struct {
+		// CheckSMTP makes readiness depend on the SMTP server too.
+		CheckSMTP bool
+		// DrainDelay is how long the server keeps serving, while reporting
+		// itself as draining, before it stops accepting connections.
+		DrainDelay time.Duration
+	}
+	Metrics struct {
+		// Addr is where the metrics server listens, apart from the public
+		// one; empty disables it.
+		Addr string
+	}
 }
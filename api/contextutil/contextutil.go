@@ -9,8 +9,20 @@ type contextKey string
 
 const userContextKey = contextKey("user")
 const nonceContextKey = contextKey("nonce")
+const accessTokenContextKey = contextKey("accessToken")
+const permissionsContextKey = contextKey("permissions")
+const impersonatorContextKey = contextKey("impersonator")
+const csrfTokenContextKey = contextKey("csrfToken")
+const requestIDContextKey = contextKey("requestID")
+const requestLogContextKey = contextKey("requestLog")
 
+// ContextSetUser also notes the user on the request's log entry, if any, so
+// the access log can report who made the request.
 func ContextSetUser(c context.Context, user *domain.User) context.Context {
+	if entry := ContextGetRequestLog(c); entry != nil {
+		entry.UserID = user.ID
+	}
+
 	return context.WithValue(c, userContextKey, user)
 }
 
@@ -35,3 +47,75 @@ func ContextGetNonce(c context.Context) string {
 
 	return nonce
 }
+
+func ContextSetAccessToken(c context.Context, token *domain.PersonalAccessToken) context.Context {
+	return context.WithValue(c, accessTokenContextKey, token)
+}
+
+// ContextGetAccessToken returns the personal access token that authenticated
+// the request, or nil when the request was authenticated by session.
+func ContextGetAccessToken(c context.Context) *domain.PersonalAccessToken {
+	token, _ := c.Value(accessTokenContextKey).(*domain.PersonalAccessToken)
+	return token
+}
+
+func ContextSetPermissions(c context.Context, permissions domain.Permissions) context.Context {
+	return context.WithValue(c, permissionsContextKey, permissions)
+}
+
+// ContextGetPermissions returns the user's effective permissions if they have
+// already been loaded during the request.
+func ContextGetPermissions(c context.Context) (domain.Permissions, bool) {
+	permissions, ok := c.Value(permissionsContextKey).(domain.Permissions)
+	return permissions, ok
+}
+
+func ContextSetImpersonator(c context.Context, user *domain.User) context.Context {
+	return context.WithValue(c, impersonatorContextKey, user)
+}
+
+// ContextGetImpersonator returns the admin signed in as the request's user,
+// or nil when nobody is being impersonated.
+func ContextGetImpersonator(c context.Context) *domain.User {
+	user, _ := c.Value(impersonatorContextKey).(*domain.User)
+	return user
+}
+
+func ContextSetCSRFToken(c context.Context, token string) context.Context {
+	return context.WithValue(c, csrfTokenContextKey, token)
+}
+
+// ContextGetCSRFToken returns the CSRF token for forms rendered outside a
+// handler's own data, such as the layout.
+func ContextGetCSRFToken(c context.Context) string {
+	token, _ := c.Value(csrfTokenContextKey).(string)
+	return token
+}
+
+func ContextSetRequestID(c context.Context, id string) context.Context {
+	return context.WithValue(c, requestIDContextKey, id)
+}
+
+// ContextGetRequestID returns the ID of the request c belongs to, or "" for a
+// context that doesn't belong to one.
+func ContextGetRequestID(c context.Context) string {
+	id, _ := c.Value(requestIDContextKey).(string)
+	return id
+}
+
+// RequestLog collects details about a request that only middleware further
+// down the chain learns, for the access log written once the request is done.
+type RequestLog struct {
+	// Route is the pattern the router matched, empty if none did.
+	Route  string
+	UserID int64
+}
+
+func ContextSetRequestLog(c context.Context, entry *RequestLog) context.Context {
+	return context.WithValue(c, requestLogContextKey, entry)
+}
+
+func ContextGetRequestLog(c context.Context) *RequestLog {
+	entry, _ := c.Value(requestLogContextKey).(*RequestLog)
+	return entry
+}
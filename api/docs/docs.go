@@ -0,0 +1,240 @@
+// Package docs holds the OpenAPI document for the /v1 JSON API and checks it
+// against the routes the server actually registers.
+package docs
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Path
+}
+
+type Document struct {
+	Info struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components struct {
+		Schemas   map[string]json.RawMessage `json:"schemas"`
+		Responses map[string]json.RawMessage `json:"responses"`
+	} `json:"components"`
+}
+
+type Operation struct {
+	OperationID string      `json:"operationId"`
+	Tags        []string    `json:"tags"`
+	Summary     string      `json:"summary"`
+	Description string      `json:"description"`
+	Parameters  []Parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]json.RawMessage `json:"responses"`
+	Security  *[]map[string][]string     `json:"security"`
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// Load parses the embedded spec.
+func Load() (*Document, error) {
+	var doc Document
+
+	err := json.Unmarshal(Spec, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("docs: parsing openapi.json: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// Routes lists every operation in the document, sorted by path then method.
+func (d *Document) Routes() []Route {
+	var routes []Route
+
+	for path, operations := range d.Paths {
+		for method := range operations {
+			routes = append(routes, Route{Method: strings.ToUpper(method), Path: path})
+		}
+	}
+
+	sortRoutes(routes)
+
+	return routes
+}
+
+var namedParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Drift compares routes registered with the router against the document.
+// Router paths use httprouter's :name syntax and are matched against the
+// spec's {name} form. missing holds registered routes the spec doesn't
+// describe; extra holds documented routes nothing serves.
+func (d *Document) Drift(registered []Route) (missing, extra []Route) {
+	documented := make(map[Route]bool)
+	for _, route := range d.Routes() {
+		documented[route] = true
+	}
+
+	served := make(map[Route]bool)
+	for _, route := range registered {
+		route.Path = namedParam.ReplaceAllString(route.Path, "{$1}")
+		served[route] = true
+
+		if !documented[route] {
+			missing = append(missing, route)
+		}
+	}
+
+	for route := range documented {
+		if !served[route] {
+			extra = append(extra, route)
+		}
+	}
+
+	sortRoutes(missing)
+	sortRoutes(extra)
+
+	return missing, extra
+}
+
+// ResponseStatuses returns the operation's response codes in order.
+func (o Operation) ResponseStatuses() []string {
+	statuses := make([]string, 0, len(o.Responses))
+	for status := range o.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	return statuses
+}
+
+// Response returns the description of the response for status and the name
+// of the schema its body uses, following references to shared responses.
+func (d *Document) Response(o Operation, status string) (description, schema string) {
+	var response struct {
+		Ref         string `json:"$ref"`
+		Description string `json:"description"`
+		Content     map[string]struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"content"`
+	}
+
+	_ = json.Unmarshal(o.Responses[status], &response)
+
+	if response.Ref != "" {
+		_ = json.Unmarshal(d.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")], &response)
+	}
+
+	if content, ok := response.Content["application/json"]; ok {
+		schema = SchemaName(content.Schema)
+	}
+
+	return response.Description, schema
+}
+
+// RequestSchema returns a short name for the schema of the request body, or
+// "" when the operation takes none.
+func (o Operation) RequestSchema() string {
+	if o.RequestBody == nil {
+		return ""
+	}
+
+	return SchemaName(o.RequestBody.Content["application/json"].Schema)
+}
+
+// Public reports whether the operation can be called without credentials.
+func (o Operation) Public() bool {
+	return o.Security != nil && len(*o.Security) == 0
+}
+
+// SchemaName describes schema briefly: the name of a referenced component,
+// an array of one, an envelope around one, or its JSON type.
+func SchemaName(schema json.RawMessage) string {
+	var s struct {
+		Ref        string                     `json:"$ref"`
+		Type       string                     `json:"type"`
+		Items      json.RawMessage            `json:"items"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+
+	if len(schema) == 0 || json.Unmarshal(schema, &s) != nil {
+		return ""
+	}
+
+	switch {
+	case s.Ref != "":
+		return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	case s.Type == "array":
+		return SchemaName(s.Items) + "[]"
+	case s.Type == "object" && len(s.Properties) > 0:
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = key + ": " + SchemaName(s.Properties[key])
+		}
+
+		return "{" + strings.Join(fields, ", ") + "}"
+	default:
+		return s.Type
+	}
+}
+
+// SchemaJSON returns the named component schema, indented for display.
+func (d *Document) SchemaJSON(name string) string {
+	var buf bytes.Buffer
+
+	err := json.Indent(&buf, d.Components.Schemas[name], "", "  ")
+	if err != nil {
+		return string(d.Components.Schemas[name])
+	}
+
+	return buf.String()
+}
+
+// SchemaNames returns the names of the component schemas in order.
+func (d *Document) SchemaNames() []string {
+	names := make([]string, 0, len(d.Components.Schemas))
+	for name := range d.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+}
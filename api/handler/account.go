@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/justinas/nosurf"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/web/views/pages"
+)
+
+func (h *Handler) accountData(r *http.Request) pages.AccountData {
+	user := contextutil.ContextGetUser(r.Context())
+
+	return pages.AccountData{
+		CSRFToken:   nosurf.Token(r),
+		Name:        user.Name,
+		Email:       user.Email,
+		HasPassword: user.HasPassword,
+	}
+}
+
+// recentLoginMessage tells users without a password that their sign-in is
+// too old to confirm a sensitive change.
+const recentLoginMessage = "sign in again to confirm it's you, then try again within 10 minutes"
+
+func (h *Handler) Account(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, pages.Account(h.accountData(r)))
+}
+
+// AccountExport sends the user a JSON archive of everything the shop holds
+// about them.
+func (h *Handler) AccountExport(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	profile, err := h.Services.Profiles.Get(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	cart, err := h.Services.Cart.Get(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	orders, err := h.Services.Orders.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	ordersRes := make([]orderRes, len(orders))
+	for i, order := range orders {
+		items, err := h.Services.Orders.GetItems(r.Context(), order.ID)
+		if err != nil {
+			httputil.ServerError(h.Logger, w, r, err)
+			return
+		}
+
+		ordersRes[i] = newOrderRes(order, items)
+	}
+
+	invoices, err := h.Services.Invoices.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	invoicesRes := make([]invoiceRes, len(invoices))
+	for i := range invoices {
+		invoicesRes[i] = newInvoiceRes(invoices[i])
+	}
+
+	reviews, err := h.Services.Reviews.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	reviewsRes := make([]reviewRes, len(reviews))
+	for i := range reviews {
+		reviewsRes[i] = newReviewRes(reviews[i])
+	}
+
+	identities, err := h.Services.Identities.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	type identityRes struct {
+		CreatedAt time.Time `json:"created_at"`
+		Provider  string    `json:"provider"`
+		Email     string    `json:"email"`
+	}
+
+	identitiesRes := make([]identityRes, len(identities))
+	for i, identity := range identities {
+		identitiesRes[i] = identityRes{
+			CreatedAt: identity.CreatedAt,
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+		}
+	}
+
+	res := httputil.Envelope{
+		"exported_at": time.Now().UTC(),
+		"profile": httputil.Envelope{
+			"id":         user.ID,
+			"created_at": user.CreatedAt,
+			"name":       user.Name,
+			"email":      user.Email,
+			"activated":  user.Activated,
+			"phone":      profile.Phone,
+			"language":   profile.Language,
+			"notifications": httputil.Envelope{
+				"orders":     profile.NotifyOrders,
+				"newsletter": profile.NotifyNewsletter,
+			},
+		},
+		"cart":       newCartRes(*cart),
+		"identities": identitiesRes,
+		"orders":     ordersRes,
+		"invoices":   invoicesRes,
+		"reviews":    reviewsRes,
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", `attachment; filename="paperback-data.json"`)
+
+	err = httputil.WriteJSON(w, http.StatusOK, res, headers)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) AccountDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		Password string `form:"password"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	err = h.Services.Users.Delete(r.Context(), service.DeleteUserReq{
+		Actor:           h.auditActor(r),
+		UserID:          user.ID,
+		Password:        form.Password,
+		AuthenticatedAt: h.SessionManager.GetTime(r.Context(), httputil.SessionKeyAuthenticatedAt),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			data := h.accountData(r)
+			data.Errors = errsx.Map{}
+			data.Errors.Set("password", "incorrect password")
+			h.render(w, r, http.StatusUnprocessableEntity, pages.Account(data))
+		case errors.Is(err, service.ErrRecentLoginRequired):
+			data := h.accountData(r)
+			data.Errors = errsx.Map{}
+			data.Errors.Set("password", recentLoginMessage)
+			h.render(w, r, http.StatusUnprocessableEntity, pages.Account(data))
+		case errors.Is(err, service.ErrEditConflict):
+			httputil.ClientError(w, r, http.StatusConflict)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	// The session row is already gone; destroying it here clears the cookie.
+	err = h.SessionManager.Destroy(r.Context())
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
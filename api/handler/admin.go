@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+)
+
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	err = h.Services.LoginThrottle.Unlock(r.Context(), h.auditActor(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"message": "user successfully unlocked"}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
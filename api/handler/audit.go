@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type auditEventRes struct {
+	ID         int64          `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	ActorID    *int64         `json:"actor_id"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	TargetID   string         `json:"target_id"`
+	Before     map[string]any `json:"before"`
+	After      map[string]any `json:"after"`
+	Details    map[string]any `json:"details"`
+	IP         string         `json:"ip"`
+	UserAgent  string         `json:"user_agent"`
+}
+
+func (h *Handler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var errs errsx.Map
+
+	req := service.GetAllAuditEventsReq{
+		ActorID:    int64(httputil.ReadInt(qs, "actor_id", 0, &errs)),
+		Action:     httputil.ReadString(qs, "action", ""),
+		TargetType: httputil.ReadString(qs, "target_type", ""),
+		TargetID:   httputil.ReadString(qs, "target_id", ""),
+		Filters: service.Filters{
+			Page:         httputil.ReadInt(qs, "page", 1, &errs),
+			PageSize:     httputil.ReadInt(qs, "page_size", 20, &errs),
+			Sort:         httputil.ReadString(qs, "sort", "-created_at"),
+			SortSafeList: []string{"id", "created_at", "-id", "-created_at"},
+		},
+	}
+
+	if errs != nil {
+		httputil.FailedValidation(h.Logger, w, r, errs)
+		return
+	}
+
+	events, metadata, err := h.Services.Audit.GetAll(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	res := make([]auditEventRes, len(events))
+	for i, event := range events {
+		res[i] = auditEventRes{
+			ID:         event.ID,
+			CreatedAt:  event.CreatedAt,
+			ActorID:    event.ActorID,
+			Action:     event.Action,
+			TargetType: event.TargetType,
+			TargetID:   event.TargetID,
+			Before:     event.Before,
+			After:      event.After,
+			Details:    event.Details,
+			IP:         event.IP,
+			UserAgent:  event.UserAgent,
+		}
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"events": res, "metadata": metadata}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
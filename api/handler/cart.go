@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type cartItemRes struct {
+	ProductID int64     `json:"product_id"`
+	Title     string    `json:"title"`
+	Price     int32     `json:"price"`
+	Quantity  int32     `json:"quantity"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+type cartRes struct {
+	Items      []cartItemRes `json:"items"`
+	TotalPrice int64         `json:"total_price"`
+}
+
+func newCartRes(cart domain.Cart) cartRes {
+	res := cartRes{
+		Items:      make([]cartItemRes, len(cart.Items)),
+		TotalPrice: cart.TotalPrice,
+	}
+
+	for i, item := range cart.Items {
+		res.Items[i] = cartItemRes{
+			ProductID: item.ProductID,
+			Title:     item.Title,
+			Price:     item.Price,
+			Quantity:  item.Quantity,
+			AddedAt:   item.AddedAt,
+		}
+	}
+
+	return res
+}
+
+// ShowCart writes the user's cart. Handlers that change the cart finish with
+// it so clients always get the cart as it now stands.
+func (h *Handler) ShowCart(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	cart, err := h.Services.Cart.Get(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"cart": newCartRes(*cart)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) SetCartItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	var input struct {
+		Quantity int32 `json:"quantity"`
+	}
+
+	err = httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	err = h.Services.Cart.SetItem(r.Context(), service.SetCartItemReq{
+		UserID:    user.ID,
+		ProductID: productID,
+		Quantity:  input.Quantity,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	h.ShowCart(w, r)
+}
+
+func (h *Handler) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	err = h.Services.Cart.RemoveItem(r.Context(), user.ID, productID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	h.ShowCart(w, r)
+}
+
+func (h *Handler) ClearCart(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	err := h.Services.Cart.Clear(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.ShowCart(w, r)
+}
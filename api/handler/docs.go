@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ruhollahh/paperback/api/docs"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/web/views/pages"
+)
+
+// OpenAPISpec serves the OpenAPI document describing the /v1 API.
+func (h *Handler) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := w.Write(docs.Spec)
+	if err != nil {
+		httputil.LogError(h.Logger, w, r, err)
+	}
+}
+
+// Docs renders the OpenAPI document as a browsable page.
+func (h *Handler) Docs(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, pages.Docs(h.APIDocs))
+}
@@ -1,13 +1,31 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
 
+	"github.com/a-h/templ"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	"github.com/julienschmidt/httprouter"
 	"github.com/ruhollahh/paperback/api/config"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/docs"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/api/metrics"
+	"github.com/ruhollahh/paperback/internal/app/domain"
 	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/internal/mailer"
+	"github.com/ruhollahh/paperback/internal/oidc"
+	"github.com/ruhollahh/paperback/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
@@ -18,4 +36,117 @@ type Handler struct {
 	Services       service.Services
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
+	OIDC           oidc.Providers
+	Mailer         mailer.Mailer
+	Wg             *sync.WaitGroup
+	APIDocs        *docs.Document
+	Metrics        *metrics.Metrics
+	Draining       *atomic.Bool
+}
+
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, status int, page templ.Component) {
+	buf := new(bytes.Buffer)
+
+	err := page.Render(r.Context(), buf)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	w.WriteHeader(status)
+
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		httputil.LogError(h.Logger, w, r, err)
+	}
+}
+
+// background runs fn outside the request. fn's context carries the request's
+// values, such as its ID and trace, but isn't cancelled when the request ends.
+func (h *Handler) background(r *http.Request, fn func(ctx context.Context)) {
+	ctx := context.WithoutCancel(r.Context())
+
+	h.Wg.Add(1)
+	h.Metrics.BackgroundTasks.Inc()
+
+	go func() {
+		defer h.Wg.Done()
+		defer h.Metrics.BackgroundTasks.Dec()
+
+		defer func() {
+			if err := recover(); err != nil {
+				h.Logger.ErrorContext(ctx, fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn(ctx)
+	}()
+}
+
+// sendMail sends an email in a span of its own and counts whether it went
+// out.
+func (h *Handler) sendMail(ctx context.Context, recipient, templateFile string, data any) error {
+	_, span := tracing.Tracer().Start(ctx, "mail.send", trace.WithAttributes(attribute.String("mail.template", templateFile)))
+	defer span.End()
+
+	err := h.Mailer.Send(recipient, templateFile, data)
+	h.Metrics.ObserveMail(templateFile, err)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sending mail failed")
+	}
+
+	return err
+}
+
+// permissions returns the signed-in user's effective permissions, reusing the
+// ones RequirePermission loaded for this request when there are any.
+func (h *Handler) permissions(r *http.Request) (domain.Permissions, error) {
+	if permissions, ok := contextutil.ContextGetPermissions(r.Context()); ok {
+		return permissions, nil
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	return h.Services.Permissions.GetAllForUser(r.Context(), user.ID)
+}
+
+// principal returns the signed-in user with the permissions they may use on
+// this request, for service.Can.
+func (h *Handler) principal(r *http.Request) (service.Principal, error) {
+	permissions, err := h.permissions(r)
+	if err != nil {
+		return service.Principal{}, err
+	}
+
+	principal := service.Principal{
+		User:        contextutil.ContextGetUser(r.Context()),
+		Permissions: permissions,
+	}
+
+	// A personal access token narrows what its owner may do to the
+	// permissions it was minted with.
+	if token := contextutil.ContextGetAccessToken(r.Context()); token != nil {
+		principal = principal.Scoped(token)
+	}
+
+	// Permissions that require two-factor authentication don't count until
+	// the user has enabled it, as with RequirePermission.
+	return h.Services.TwoFactor.Enforce(r.Context(), principal)
+}
+
+// auditActor describes the signed-in user and their request for the audit
+// trail. While impersonating, the admin is the one held responsible.
+func (h *Handler) auditActor(r *http.Request) domain.AuditActor {
+	user := contextutil.ContextGetUser(r.Context())
+	if impersonator := contextutil.ContextGetImpersonator(r.Context()); impersonator != nil {
+		user = impersonator
+	}
+
+	return domain.AuditActor{
+		UserID:    user.ID,
+		IP:        httputil.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
 }
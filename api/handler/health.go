@@ -1,32 +1,127 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/migrations"
 )
 
+type healthCheckRes struct {
+	Status string `json:"status"`
+	// Reason says briefly what is wrong; the full error goes to the log.
+	Reason string         `json:"reason,omitempty"`
+	Detail map[string]any `json:"detail,omitempty"`
+}
+
+// Liveness reports that the process is up and serving. It doesn't look at any
+// dependency, so an outage elsewhere never gets the server restarted.
+func (h *Handler) Liveness(w http.ResponseWriter, r *http.Request) {
+	err := httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"status": "alive"}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+// HealthCheck reports whether the server is ready for traffic: the database
+// answers, its schema is the one this build expects and, if configured, the
+// SMTP server accepts connections. While shutting down it reports draining.
+// Anything but available comes with a 503.
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	data := map[string]any{
-		"status": "available",
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	checks := map[string]healthCheckRes{
+		"database":   h.checkDatabase(ctx),
+		"migrations": h.checkMigrations(ctx),
+	}
+	if h.Config.Health.CheckSMTP {
+		checks["smtp"] = h.checkSMTP(ctx)
+	}
+
+	status := "available"
+	for _, check := range checks {
+		if check.Status != "up" {
+			status = "unavailable"
+		}
+	}
+	if h.Draining.Load() {
+		status = "draining"
+	}
+
+	code := http.StatusOK
+	if status != "available" {
+		code = http.StatusServiceUnavailable
+	}
+
+	res := httputil.Envelope{
+		"status": status,
+		"checks": checks,
 		"system_info": map[string]string{
 			"environment": h.Config.Env,
 			"version":     h.Version,
 		},
 	}
 
-	jsonData, err := json.MarshalIndent(data, "", "\t")
+	err := httputil.WriteJSON(w, code, res, nil)
 	if err != nil {
 		httputil.ServerError(h.Logger, w, r, err)
-		return
 	}
+}
+
+func (h *Handler) healthCheckFailed(ctx context.Context, component, reason string, err error) healthCheckRes {
+	h.Logger.WarnContext(ctx, "health check failed", "component", component, "error", err)
+
+	return healthCheckRes{Status: "down", Reason: reason}
+}
 
-	w.Header().Set("Content-Type", "application/json")
+func (h *Handler) checkDatabase(ctx context.Context) healthCheckRes {
+	start := time.Now()
 
-	_, err = w.Write(jsonData)
+	err := h.Services.Health.Ping(ctx)
 	if err != nil {
-		httputil.ServerError(h.Logger, w, r, err)
-		return
+		return h.healthCheckFailed(ctx, "database", "unreachable", err)
+	}
+
+	return healthCheckRes{
+		Status: "up",
+		Detail: map[string]any{"latency": time.Since(start).String()},
+	}
+}
+
+func (h *Handler) checkMigrations(ctx context.Context) healthCheckRes {
+	want, err := migrations.Latest()
+	if err != nil {
+		return h.healthCheckFailed(ctx, "migrations", "unreadable migrations", err)
+	}
+
+	version, dirty, err := h.Services.Health.MigrationVersion(ctx)
+	if err != nil {
+		return h.healthCheckFailed(ctx, "migrations", "unreadable schema version", err)
 	}
+
+	detail := map[string]any{"version": version, "expected": want}
+
+	switch {
+	case dirty:
+		h.Logger.WarnContext(ctx, "health check failed", "component", "migrations", "version", version, "dirty", true)
+		return healthCheckRes{Status: "down", Reason: "last migration failed", Detail: detail}
+	case version != want:
+		h.Logger.WarnContext(ctx, "health check failed", "component", "migrations", "version", version, "expected", want)
+		return healthCheckRes{Status: "down", Reason: fmt.Sprintf("schema is at version %d, want %d", version, want), Detail: detail}
+	}
+
+	return healthCheckRes{Status: "up", Detail: detail}
+}
+
+func (h *Handler) checkSMTP(ctx context.Context) healthCheckRes {
+	err := h.Mailer.Ping(ctx)
+	if err != nil {
+		return h.healthCheckFailed(ctx, "smtp", "unreachable", err)
+	}
+
+	return healthCheckRes{Status: "up"}
 }
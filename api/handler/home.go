@@ -1,12 +1,11 @@
 package handler
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/ruhollahh/paperback/web/views/pages"
 )
 
-func (h *Handler) Home(w http.ResponseWriter, _ *http.Request) {
-	pages.Home().Render(context.Background(), w)
+func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, pages.Home())
 }
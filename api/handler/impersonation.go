@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+)
+
+// ImpersonateUserPost signs the admin in as another user, remembering who
+// they really are so they can switch back.
+func (h *Handler) ImpersonateUserPost(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	admin := contextutil.ContextGetUser(r.Context())
+
+	// Impersonation doesn't nest, and an admin can't become themselves.
+	if contextutil.ContextGetImpersonator(r.Context()) != nil || admin.ID == id {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.Services.Users.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	permissions, err := h.Services.Permissions.GetAllForUser(r.Context(), target.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	// Taking over another admin would be a way around one's own permissions.
+	if service.PermissionsInclude(permissions, domain.PermissionUsersImpersonate) ||
+		service.PermissionsInclude(permissions, domain.PermissionPermissionsManage) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	err = h.Services.Audit.Record(r.Context(), h.auditActor(r), domain.AuditActionImpersonationStart, domain.AuditTargetUser, target.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = h.renewTrackedSession(r, admin.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyImpersonatorID, admin.ID)
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyAuthenticatedUserID, target.ID)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (h *Handler) StopImpersonationPost(w http.ResponseWriter, r *http.Request) {
+	admin := contextutil.ContextGetImpersonator(r.Context())
+	if admin == nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	target := contextutil.ContextGetUser(r.Context())
+
+	err := h.Services.Audit.Record(r.Context(), h.auditActor(r), domain.AuditActionImpersonationStop, domain.AuditTargetUser, target.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = h.renewTrackedSession(r, admin.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.SessionManager.Remove(r.Context(), httputil.SessionKeyImpersonatorID)
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyAuthenticatedUserID, admin.ID)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// renewTrackedSession issues a new session token and moves the session index
+// entry over to it, still owned by userID.
+func (h *Handler) renewTrackedSession(r *http.Request, userID int64) error {
+	err := h.Services.Sessions.Delete(r.Context(), h.SessionManager.Token(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	err = h.SessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return h.Services.Sessions.Register(r.Context(), service.RegisterSessionReq{
+		Token:     h.SessionManager.Token(r.Context()),
+		UserID:    userID,
+		IP:        httputil.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+}
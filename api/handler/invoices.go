@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+)
+
+type invoiceRes struct {
+	ID        int64                `json:"id"`
+	OrderID   int64                `json:"order_id"`
+	CreatedAt time.Time            `json:"created_at"`
+	Status    domain.InvoiceStatus `json:"status"`
+	Version   int32                `json:"version"`
+}
+
+func newInvoiceRes(invoice domain.Invoice) invoiceRes {
+	return invoiceRes{
+		ID:        invoice.ID,
+		OrderID:   invoice.OrderID,
+		CreatedAt: invoice.CreatedAt,
+		Status:    invoice.Status,
+		Version:   invoice.Version,
+	}
+}
+
+func (h *Handler) ListInvoices(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	invoices, err := h.Services.Invoices.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	res := make([]invoiceRes, len(invoices))
+	for i := range invoices {
+		res[i] = newInvoiceRes(invoices[i])
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"invoices": res}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ShowInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	invoice, err := h.Services.Invoices.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if !service.Can(principal, service.ActionRead, invoice) {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"invoice": newInvoiceRes(*invoice)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
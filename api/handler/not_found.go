@@ -5,6 +5,10 @@ import (
 	"net/http"
 )
 
-func (h *Handler) NotFound(w http.ResponseWriter, _ *http.Request) {
-	httputil.NotFoundError(w)
+func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
+	httputil.NotFoundError(w, r)
+}
+
+func (h *Handler) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	httputil.ClientError(w, r, http.StatusMethodNotAllowed)
 }
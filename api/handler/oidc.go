@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/internal/oidc"
+)
+
+func (h *Handler) LoginOIDC(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+
+	provider, err := h.OIDC.Get(name)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	authReq, err := oidc.NewAuthRequest()
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), authReq)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyOIDCProvider, name)
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyOIDCState, authReq.State)
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyOIDCNonce, authReq.Nonce)
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyOIDCCodeVerifier, authReq.CodeVerifier)
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h *Handler) LoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+
+	provider, err := h.OIDC.Get(name)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	// The auth request is single use whatever the outcome.
+	authReq := &oidc.AuthRequest{
+		State:        h.SessionManager.PopString(r.Context(), httputil.SessionKeyOIDCState),
+		Nonce:        h.SessionManager.PopString(r.Context(), httputil.SessionKeyOIDCNonce),
+		CodeVerifier: h.SessionManager.PopString(r.Context(), httputil.SessionKeyOIDCCodeVerifier),
+	}
+	sessionProvider := h.SessionManager.PopString(r.Context(), httputil.SessionKeyOIDCProvider)
+
+	query := r.URL.Query()
+
+	if authReq.State == "" || sessionProvider != name ||
+		subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(authReq.State)) != 1 {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("error") != "" {
+		h.Logger.InfoContext(r.Context(), "oidc login rejected by provider", "provider", name, "error", query.Get("error"))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), authReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			httputil.LogError(h.Logger, w, r, err)
+			httputil.ClientError(w, r, http.StatusUnauthorized)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	user, err := h.Services.Identities.LoginWithIdentity(r.Context(), service.LoginWithIdentityReq{
+		Provider:      name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnverifiedEmail):
+			httputil.ClientError(w, r, http.StatusForbidden)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	h.startLogin(w, r, user)
+}
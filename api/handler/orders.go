@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type orderItemRes struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int32 `json:"quantity"`
+	Price     int32 `json:"price"`
+}
+
+type orderRes struct {
+	ID         int64              `json:"id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UserID     int64              `json:"user_id"`
+	TotalPrice int32              `json:"total_price"`
+	Status     domain.OrderStatus `json:"status"`
+	Items      []orderItemRes     `json:"items,omitempty"`
+	Version    int32              `json:"version"`
+}
+
+func newOrderRes(order domain.Order, items []domain.OrderItem) orderRes {
+	res := orderRes{
+		ID:         order.ID,
+		CreatedAt:  order.CreatedAt,
+		UserID:     order.UserID,
+		TotalPrice: order.TotalPrice,
+		Status:     order.Status,
+		Items:      make([]orderItemRes, len(items)),
+		Version:    order.Version,
+	}
+
+	for i, item := range items {
+		res.Items[i] = orderItemRes{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		}
+	}
+
+	return res
+}
+
+func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	orders, err := h.Services.Orders.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	res := make([]orderRes, len(orders))
+	for i := range orders {
+		res[i] = newOrderRes(orders[i], nil)
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"orders": res}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+// CreateOrder checks out the user's cart.
+func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	order, items, err := h.Services.Orders.Checkout(r.Context(), user.ID)
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	h.Metrics.OrdersPlaced.Inc()
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/orders/%d", order.ID))
+
+	err = httputil.WriteJSON(w, http.StatusCreated, httputil.Envelope{"order": newOrderRes(*order, items)}, headers)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ShowOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	order, err := h.Services.Orders.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	// Other users' orders are reported as missing rather than forbidden, so
+	// their IDs can't be probed.
+	if !service.Can(principal, service.ActionRead, order) {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	items, err := h.Services.Orders.GetItems(r.Context(), order.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"order": newOrderRes(*order, items)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	order, err := h.Services.Orders.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if !service.Can(principal, service.ActionRead, order) {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	if !service.Can(principal, service.ActionDelete, order) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var input struct {
+		Version int32 `json:"version"`
+	}
+
+	err = httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	order, err = h.Services.Orders.Cancel(r.Context(), service.CancelOrderReq{
+		Actor:   h.auditActor(r),
+		ID:      order.ID,
+		Version: input.Version,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		case errors.Is(err, service.ErrEditConflict):
+			httputil.ClientError(w, r, http.StatusConflict)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	h.Metrics.OrdersCancelled.Inc()
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"order": newOrderRes(*order, nil)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
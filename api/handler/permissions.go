@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+func (h *Handler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := h.Services.Permissions.GetAll(r.Context())
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"permissions": permissions}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ListPermissionUsers(w http.ResponseWriter, r *http.Request) {
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	users, err := h.Services.Permissions.GetUsersWithPermission(r.Context(), code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	type userRes struct {
+		ID        int64     `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		Name      string    `json:"name"`
+		Email     string    `json:"email"`
+		Activated bool      `json:"activated"`
+	}
+
+	res := make([]userRes, len(users))
+	for i, user := range users {
+		res[i] = userRes{
+			ID:        user.ID,
+			CreatedAt: user.CreatedAt,
+			Name:      user.Name,
+			Email:     user.Email,
+			Activated: user.Activated,
+		}
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"users": res}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.Services.Roles.GetAll(r.Context())
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	type roleRes struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+	}
+
+	res := make([]roleRes, len(roles))
+	for i, role := range roles {
+		res[i] = roleRes{Name: role.Name, Permissions: role.Permissions}
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"roles": res}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ShowUserPermissions(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	_, err = h.Services.Users.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	effective, err := h.Services.Permissions.GetAllForUser(r.Context(), id)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	direct, err := h.Services.Permissions.GetDirectForUser(r.Context(), id)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	roles, err := h.Services.Roles.GetAllForUser(r.Context(), id)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	res := httputil.Envelope{
+		"permissions": effective,
+		"direct":      direct,
+		"roles":       roles,
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, res, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) GrantUserPermissions(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err = httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	err = h.Services.Permissions.GrantForUser(r.Context(), service.ChangePermissionsReq{
+		Actor:  h.auditActor(r),
+		UserID: id,
+		Codes:  input.Permissions,
+	})
+	h.grantsChanged(w, r, err, "permissions successfully granted")
+}
+
+func (h *Handler) RevokeUserPermission(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+	err = h.Services.Permissions.RevokeForUser(r.Context(), service.ChangePermissionsReq{
+		Actor:  h.auditActor(r),
+		UserID: id,
+		Codes:  []string{code},
+	})
+	h.grantsChanged(w, r, err, "permission successfully revoked")
+}
+
+func (h *Handler) GrantUserRoles(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err = httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	err = h.Services.Roles.GrantForUser(r.Context(), service.ChangeRolesReq{
+		Actor:  h.auditActor(r),
+		UserID: id,
+		Roles:  input.Roles,
+	})
+	h.grantsChanged(w, r, err, "roles successfully granted")
+}
+
+func (h *Handler) RevokeUserRole(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	role := httprouter.ParamsFromContext(r.Context()).ByName("role")
+	err = h.Services.Roles.RevokeForUser(r.Context(), service.ChangeRolesReq{
+		Actor:  h.auditActor(r),
+		UserID: id,
+		Roles:  []string{role},
+	})
+	h.grantsChanged(w, r, err, "role successfully revoked")
+}
+
+func (h *Handler) grantsChanged(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"message": message}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type productRes struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Price       int32     `json:"price"`
+	PublisherID *int64    `json:"publisher_id"`
+	Version     int32     `json:"version"`
+}
+
+func newProductRes(product domain.Product) productRes {
+	return productRes{
+		ID:          product.ID,
+		CreatedAt:   product.CreatedAt,
+		Title:       product.Title,
+		Description: product.Description,
+		Price:       product.Price,
+		PublisherID: product.PublisherID,
+		Version:     product.Version,
+	}
+}
+
+func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var errs errsx.Map
+
+	title := httputil.ReadString(qs, "title", "")
+	filters := service.Filters{
+		Page:         httputil.ReadInt(qs, "page", 1, &errs),
+		PageSize:     httputil.ReadInt(qs, "page_size", 20, &errs),
+		Sort:         httputil.ReadString(qs, "sort", "id"),
+		SortSafeList: []string{"id", "title", "price", "created_at", "-id", "-title", "-price", "-created_at"},
+	}
+
+	if errs != nil {
+		httputil.FailedValidation(h.Logger, w, r, errs)
+		return
+	}
+
+	products, metadata, err := h.Services.Products.GetAll(r.Context(), title, filters)
+	if err != nil {
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	res := make([]productRes, len(products))
+	for i := range products {
+		res[i] = newProductRes(products[i])
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"products": res, "metadata": metadata}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ShowProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	product, err := h.Services.Products.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"product": newProductRes(*product)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if !service.Can(principal, service.ActionCreate, &domain.Product{}) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Price       int32  `json:"price"`
+	}
+
+	err = httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	product := domain.Product{
+		Title:       input.Title,
+		Description: input.Description,
+		Price:       input.Price,
+	}
+
+	// Publishers own what they create; products:write holders add to the
+	// catalogue itself.
+	if !principal.Has(domain.PermissionProductsWrite) {
+		product.PublisherID = &principal.User.ID
+	}
+
+	res, err := h.Services.Products.CreateProduct(r.Context(), service.CreateProductReq{
+		Actor:       h.auditActor(r),
+		Title:       product.Title,
+		Description: product.Description,
+		Price:       product.Price,
+		PublisherID: product.PublisherID,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+	product.ID, product.CreatedAt, product.Version = res.ID, res.CreatedAt, res.Version
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/products/%d", product.ID))
+
+	err = httputil.WriteJSON(w, http.StatusCreated, httputil.Envelope{"product": newProductRes(product)}, headers)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	product, err := h.Services.Products.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if !service.Can(principal, service.ActionUpdate, product) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Price       *int32  `json:"price"`
+	}
+
+	err = httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		product.Title = *input.Title
+	}
+	if input.Description != nil {
+		product.Description = *input.Description
+	}
+	if input.Price != nil {
+		product.Price = *input.Price
+	}
+
+	res, err := h.Services.Products.Update(r.Context(), service.UpdateProductReq{
+		Actor:       h.auditActor(r),
+		ID:          product.ID,
+		Title:       product.Title,
+		Description: product.Description,
+		Price:       product.Price,
+		Version:     product.Version,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		case errors.Is(err, service.ErrEditConflict):
+			httputil.ClientError(w, r, http.StatusConflict)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+	product.Version = res.Version
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"product": newProductRes(*product)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	product, err := h.Services.Products.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if !service.Can(principal, service.ActionDelete, product) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	err = h.Services.Products.Delete(r.Context(), h.auditActor(r), product.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		case errors.Is(err, service.ErrProductOrdered):
+			httputil.ErrorResponse(w, r, http.StatusConflict, "the product has been ordered and can't be deleted")
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"message": "product successfully deleted"}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
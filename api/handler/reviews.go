@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type reviewRes struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ProductID int64     `json:"product_id"`
+	UserID    int64     `json:"user_id"`
+	Rating    int32     `json:"rating"`
+	Body      string    `json:"body"`
+	Version   int32     `json:"version"`
+}
+
+func newReviewRes(review domain.Review) reviewRes {
+	return reviewRes{
+		ID:        review.ID,
+		CreatedAt: review.CreatedAt,
+		ProductID: review.ProductID,
+		UserID:    review.UserID,
+		Rating:    review.Rating,
+		Body:      review.Body,
+		Version:   review.Version,
+	}
+}
+
+func (h *Handler) CreateReview(w http.ResponseWriter, r *http.Request) {
+	productID, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	if !service.Can(principal, service.ActionCreate, &domain.Review{ProductID: productID, UserID: user.ID}) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var input struct {
+		Rating int32  `json:"rating"`
+		Body   string `json:"body"`
+	}
+
+	err = httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	review, err := h.Services.Reviews.Create(r.Context(), service.CreateReviewReq{
+		ProductID: productID,
+		UserID:    user.ID,
+		Rating:    input.Rating,
+		Body:      input.Body,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		case errors.Is(err, service.ErrDuplicateReview):
+			errs.Set("product_id", "has already been reviewed by this user")
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusCreated, httputil.Envelope{"review": newReviewRes(*review)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	review, principal, ok := h.readReview(w, r)
+	if !ok {
+		return
+	}
+
+	if !service.Can(principal, service.ActionUpdate, review) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var input struct {
+		Rating *int32  `json:"rating"`
+		Body   *string `json:"body"`
+	}
+
+	err := httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	review.Version, err = h.Services.Reviews.Update(r.Context(), service.UpdateReviewReq{
+		ID:      review.ID,
+		Rating:  review.Rating,
+		Body:    review.Body,
+		Version: review.Version,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		case errors.Is(err, service.ErrEditConflict):
+			httputil.ClientError(w, r, http.StatusConflict)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"review": newReviewRes(*review)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	review, principal, ok := h.readReview(w, r)
+	if !ok {
+		return
+	}
+
+	if !service.Can(principal, service.ActionDelete, review) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	err := h.Services.Reviews.Delete(r.Context(), review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+// readReview loads the review named in the URL along with the principal to
+// authorize against, writing the error response itself when it can't.
+func (h *Handler) readReview(w http.ResponseWriter, r *http.Request) (*domain.Review, service.Principal, bool) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return nil, service.Principal{}, false
+	}
+
+	review, err := h.Services.Reviews.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return nil, service.Principal{}, false
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return nil, service.Principal{}, false
+	}
+
+	return review, principal, true
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/justinas/nosurf"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/web/views/pages"
+)
+
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	sessions, err := h.Services.Sessions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, pages.Sessions(pages.SessionsData{
+		CSRFToken:    nosurf.Token(r),
+		CurrentToken: h.SessionManager.Token(r.Context()),
+		Sessions:     sessions,
+	}))
+}
+
+func (h *Handler) RevokeSessionPost(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	err = h.Services.Sessions.Revoke(r.Context(), user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+func (h *Handler) RevokeOtherSessionsPost(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	err := h.Services.Sessions.RevokeAllForUser(r.Context(), user.ID, h.SessionManager.Token(r.Context()))
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
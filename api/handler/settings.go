@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/justinas/nosurf"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/web/views/pages"
+)
+
+func (h *Handler) Settings(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	profile, err := h.Services.Profiles.Get(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, pages.Settings(pages.SettingsData{
+		CSRFToken:   nosurf.Token(r),
+		Profile:     *profile,
+		HasPassword: user.HasPassword,
+	}))
+}
+
+func (h *Handler) SettingsProfilePost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		Name             string `form:"name"`
+		Phone            string `form:"phone"`
+		Language         string `form:"language"`
+		NotifyOrders     bool   `form:"notify_orders"`
+		NotifyNewsletter bool   `form:"notify_newsletter"`
+		Version          int32  `form:"version"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	_, err = h.Services.Profiles.Update(r.Context(), service.UpdateProfileReq{
+		Actor:            h.auditActor(r),
+		UserID:           user.ID,
+		Name:             form.Name,
+		Phone:            form.Phone,
+		Language:         form.Language,
+		NotifyOrders:     form.NotifyOrders,
+		NotifyNewsletter: form.NotifyNewsletter,
+		Version:          form.Version,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+		case errors.Is(err, service.ErrEditConflict):
+			errs.Set("version", "your account was changed elsewhere, please review and try again")
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+			return
+		}
+
+		// Show what the user typed, against the stored version so a
+		// conflicting save can simply be resubmitted.
+		profile, err := h.Services.Profiles.Get(r.Context(), user.ID)
+		if err != nil {
+			httputil.ServerError(h.Logger, w, r, err)
+			return
+		}
+		profile.Name = form.Name
+		profile.Phone = form.Phone
+		profile.Language = form.Language
+		profile.NotifyOrders = form.NotifyOrders
+		profile.NotifyNewsletter = form.NotifyNewsletter
+
+		h.render(w, r, http.StatusUnprocessableEntity, pages.Settings(pages.SettingsData{
+			CSRFToken:     nosurf.Token(r),
+			Profile:       *profile,
+			HasPassword:   user.HasPassword,
+			ProfileErrors: errs,
+		}))
+		return
+	}
+
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+func (h *Handler) SettingsPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		CurrentPassword string `form:"current_password"`
+		NewPassword     string `form:"new_password"`
+		Version         int32  `form:"version"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	_, err = h.Services.Profiles.ChangePassword(r.Context(), service.ChangePasswordReq{
+		Actor:            h.auditActor(r),
+		UserID:           user.ID,
+		CurrentPassword:  form.CurrentPassword,
+		NewPassword:      form.NewPassword,
+		Version:          form.Version,
+		AuthenticatedAt:  h.SessionManager.GetTime(r.Context(), httputil.SessionKeyAuthenticatedAt),
+		KeepSessionToken: h.SessionManager.Token(r.Context()),
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+		case errors.Is(err, service.ErrInvalidCredentials):
+			errs.Set("current_password", "incorrect password")
+		case errors.Is(err, service.ErrRecentLoginRequired):
+			errs.Set("current_password", recentLoginMessage)
+		case errors.Is(err, service.ErrEditConflict):
+			errs.Set("version", "your account was changed elsewhere, please try again")
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+			return
+		}
+
+		profile, err := h.Services.Profiles.Get(r.Context(), user.ID)
+		if err != nil {
+			httputil.ServerError(h.Logger, w, r, err)
+			return
+		}
+
+		h.render(w, r, http.StatusUnprocessableEntity, pages.Settings(pages.SettingsData{
+			CSRFToken:      nosurf.Token(r),
+			Profile:        *profile,
+			HasPassword:    user.HasPassword,
+			PasswordErrors: errs,
+		}))
+		return
+	}
+
+	err = h.renewTrackedSession(r, user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyAuthenticatedUserID, user.ID)
+
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type personalAccessTokenRes struct {
+	ID          int64              `json:"id"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Name        string             `json:"name"`
+	Prefix      string             `json:"prefix"`
+	Permissions domain.Permissions `json:"permissions"`
+	Expiry      *time.Time         `json:"expiry"`
+	LastUsedAt  *time.Time         `json:"last_used_at"`
+}
+
+func newPersonalAccessTokenRes(token domain.PersonalAccessToken) personalAccessTokenRes {
+	return personalAccessTokenRes{
+		ID:          token.ID,
+		CreatedAt:   token.CreatedAt,
+		Name:        token.Name,
+		Prefix:      token.Prefix,
+		Permissions: token.Permissions,
+		Expiry:      token.Expiry,
+		LastUsedAt:  token.LastUsedAt,
+	}
+}
+
+func (h *Handler) ListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	tokens, err := h.Services.PersonalAccessTokens.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	res := make([]personalAccessTokenRes, len(tokens))
+	for i := range tokens {
+		res[i] = newPersonalAccessTokenRes(tokens[i])
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"tokens": res}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	// Tokens are minted from an interactive session only, so a leaked token
+	// can't be used to mint more of itself.
+	if contextutil.ContextGetAccessToken(r.Context()) != nil {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var input struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+		TTLDays     int      `json:"ttl_days"`
+	}
+
+	err := httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	token, err := h.Services.PersonalAccessTokens.New(r.Context(), service.CreatePersonalAccessTokenReq{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Permissions: input.Permissions,
+		TTLDays:     input.TTLDays,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	res := struct {
+		personalAccessTokenRes
+		Token string `json:"token"`
+	}{
+		personalAccessTokenRes: newPersonalAccessTokenRes(*token),
+		Token:                  token.Plaintext,
+	}
+
+	err = httputil.WriteJSON(w, http.StatusCreated, httputil.Envelope{"token": res}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) RevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	err = h.Services.PersonalAccessTokens.Revoke(r.Context(), user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"message": "token successfully revoked"}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+// CreateActivationToken emails a fresh activation token to a user who hasn't
+// activated their account yet. The response is the same whether or not such
+// a user exists, so it can't be used to find out who has an account.
+func (h *Handler) CreateActivationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	var errs errsx.Map
+
+	user, err := h.Services.Users.GetByEmail(r.Context(), input.Email)
+	switch {
+	case errors.As(err, &errs):
+		httputil.FailedValidation(h.Logger, w, r, errs)
+		return
+	case errors.Is(err, service.ErrRecordNotFound):
+	case err != nil:
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	case !user.Activated:
+		token, err := h.Services.Tokens.New(r.Context(), user.ID, activationTokenTTL, domain.ActivationScope)
+		if err != nil {
+			httputil.ServerError(h.Logger, w, r, err)
+			return
+		}
+
+		h.background(r, func(ctx context.Context) {
+			data := map[string]any{
+				"activationToken": token.Plaintext,
+			}
+
+			err := h.sendMail(ctx, user.Email, "token_activation.tmpl", data)
+			if err != nil {
+				h.Logger.ErrorContext(ctx, err.Error())
+			}
+		})
+	}
+
+	message := "if the address belongs to an account awaiting activation, an email with activation instructions is on its way"
+
+	err = httputil.WriteJSON(w, http.StatusAccepted, httputil.Envelope{"message": message}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/justinas/nosurf"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/web/views/pages"
+)
+
+func (h *Handler) twoFactorSettingsData(r *http.Request) (pages.TwoFactorSettingsData, error) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	data := pages.TwoFactorSettingsData{CSRFToken: nosurf.Token(r)}
+
+	permissions, err := h.permissions(r)
+	if err != nil {
+		return data, err
+	}
+	data.Required = h.Services.TwoFactor.RequiredFor(permissions)
+
+	t, err := h.Services.TwoFactor.Get(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			return data, nil
+		default:
+			return data, err
+		}
+	}
+
+	data.Enabled = t.Confirmed()
+	if data.Enabled {
+		data.RemainingRecoveryCodes, err = h.Services.TwoFactor.RemainingRecoveryCodes(r.Context(), user.ID)
+	}
+
+	return data, err
+}
+
+func (h *Handler) TwoFactorSettings(w http.ResponseWriter, r *http.Request) {
+	data, err := h.twoFactorSettingsData(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, pages.TwoFactorSettings(data))
+}
+
+func (h *Handler) TwoFactorEnrollPost(w http.ResponseWriter, r *http.Request) {
+	user := contextutil.ContextGetUser(r.Context())
+
+	enrollment, err := h.Services.TwoFactor.Enroll(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTwoFactorEnabled):
+			http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	data, err := h.twoFactorSettingsData(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	data.Secret = enrollment.Secret
+	data.ProvisioningURI = enrollment.ProvisioningURI
+
+	h.render(w, r, http.StatusOK, pages.TwoFactorSettings(data))
+}
+
+func (h *Handler) TwoFactorConfirmPost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		Code string `form:"code"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	codes, err := h.Services.TwoFactor.Confirm(r.Context(), user.ID, form.Code)
+	if err == nil {
+		h.render(w, r, http.StatusOK, pages.RecoveryCodes(codes))
+		return
+	}
+
+	var errs errsx.Map
+	switch {
+	case errors.As(err, &errs):
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		errs.Set("code", "invalid code, check your authenticator app's clock and try again")
+	case errors.Is(err, service.ErrRecordNotFound):
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	default:
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	// Show the pending secret again so the user can retry with a new code.
+	t, err := h.Services.TwoFactor.Get(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	data, err := h.twoFactorSettingsData(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	data.Secret = t.Secret
+	data.ProvisioningURI = h.Services.TwoFactor.ProvisioningURI(user, t.Secret)
+	data.Errors = errs
+
+	h.render(w, r, http.StatusUnprocessableEntity, pages.TwoFactorSettings(data))
+}
+
+func (h *Handler) TwoFactorRecoveryCodesPost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		Code string `form:"code"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	codes, err := h.Services.TwoFactor.RegenerateRecoveryCodes(r.Context(), user.ID, form.Code)
+	if err != nil {
+		h.twoFactorSettingsError(w, r, "regenerate", err)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, pages.RecoveryCodes(codes))
+}
+
+func (h *Handler) TwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		Code string `form:"code"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user := contextutil.ContextGetUser(r.Context())
+
+	permissions, err := h.permissions(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if h.Services.TwoFactor.RequiredFor(permissions) {
+		httputil.ClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	err = h.Services.TwoFactor.Disable(r.Context(), user.ID, form.Code)
+	if err != nil {
+		h.twoFactorSettingsError(w, r, "disable", err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+}
+
+func (h *Handler) twoFactorSettingsError(w http.ResponseWriter, r *http.Request, field string, err error) {
+	var errs errsx.Map
+	switch {
+	case errors.As(err, &errs):
+		errs = errsx.Map{field: errs["code"]}
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		errs.Set(field, "invalid or already used code")
+	default:
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	data, err := h.twoFactorSettingsData(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	data.Errors = errs
+
+	h.render(w, r, http.StatusUnprocessableEntity, pages.TwoFactorSettings(data))
+}
@@ -0,0 +1,560 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/justinas/nosurf"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/web/views/pages"
+)
+
+// pendingTwoFactorTTL bounds how long a password-verified login may wait for
+// its second factor before the user has to start again.
+const pendingTwoFactorTTL = 5 * time.Minute
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, pages.Login(h.loginData(r)))
+}
+
+func (h *Handler) loginData(r *http.Request) pages.LoginData {
+	providers := h.OIDC.Names()
+	sort.Strings(providers)
+
+	return pages.LoginData{
+		CSRFToken: nosurf.Token(r),
+		Providers: providers,
+	}
+}
+
+func (h *Handler) LoginPost(w http.ResponseWriter, r *http.Request) {
+	var form struct {
+		Email    string `form:"email"`
+		Password string `form:"password"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	data := h.loginData(r)
+	data.Email = form.Email
+
+	retryAfter, err := h.Services.LoginThrottle.Check(r.Context(), form.Email, httputil.ClientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrLoginThrottled):
+			data.Errors.Set("credentials", throttledMessage(err, retryAfter))
+			h.renderThrottled(w, r, retryAfter, pages.Login(data))
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	user, err := h.Services.Users.Authenticate(r.Context(), service.AuthenticateReq{
+		Email:    form.Email,
+		Password: form.Password,
+	})
+	if err != nil {
+		switch {
+		case errors.As(err, &data.Errors):
+			h.render(w, r, http.StatusUnprocessableEntity, pages.Login(data))
+		case errors.Is(err, service.ErrInvalidCredentials):
+			err = h.recordLoginFailure(r, form.Email)
+			if err != nil {
+				httputil.ServerError(h.Logger, w, r, err)
+				return
+			}
+
+			data.Errors.Set("credentials", "email or password is incorrect")
+			h.render(w, r, http.StatusUnprocessableEntity, pages.Login(data))
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = h.Services.Users.Rehash(r.Context(), user, form.Password)
+	if err != nil {
+		h.Logger.ErrorContext(r.Context(), "upgrading password hash", "user_id", user.ID, "error", err)
+	}
+
+	h.startLogin(w, r, user)
+}
+
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if h.pendingTwoFactorUserID(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, pages.LoginTwoFactor(pages.LoginTwoFactorData{CSRFToken: nosurf.Token(r)}))
+}
+
+func (h *Handler) LoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	id := h.pendingTwoFactorUserID(r)
+	if id == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form struct {
+		Code string `form:"code"`
+	}
+
+	err := httputil.DecodePostForm(h.FormDecoder, r, &form)
+	if err != nil {
+		httputil.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	data := pages.LoginTwoFactorData{CSRFToken: nosurf.Token(r)}
+
+	user, err := h.Services.Users.GetByID(r.Context(), id)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	retryAfter, err := h.Services.LoginThrottle.Check(r.Context(), user.Email, httputil.ClientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrLoginThrottled):
+			data.Errors.Set("code", throttledMessage(err, retryAfter))
+			h.renderThrottled(w, r, retryAfter, pages.LoginTwoFactor(data))
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = h.Services.TwoFactor.Verify(r.Context(), id, form.Code)
+	if err != nil {
+		switch {
+		case errors.As(err, &data.Errors):
+			h.render(w, r, http.StatusUnprocessableEntity, pages.LoginTwoFactor(data))
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			err = h.recordLoginFailure(r, user.Email)
+			if err != nil {
+				httputil.ServerError(h.Logger, w, r, err)
+				return
+			}
+
+			data.Errors.Set("code", "invalid or already used code")
+			h.render(w, r, http.StatusUnprocessableEntity, pages.LoginTwoFactor(data))
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = h.SessionManager.RenewToken(r.Context())
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.SessionManager.Remove(r.Context(), httputil.SessionKeyPendingTwoFactorUserID)
+	h.SessionManager.Remove(r.Context(), httputil.SessionKeyPendingTwoFactorAt)
+
+	h.completeLogin(w, r, user)
+}
+
+// LogoutPost ends the session outright rather than just signing the user out
+// of it, so nothing in it, such as the admin behind an impersonation, is left
+// for whoever signs in next on this browser.
+func (h *Handler) LogoutPost(w http.ResponseWriter, r *http.Request) {
+	err := h.Services.Sessions.Delete(r.Context(), h.SessionManager.Token(r.Context()))
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = h.SessionManager.Destroy(r.Context())
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// startLogin continues a login once the user's first factor (a password or
+// an external identity) has been verified.
+func (h *Handler) startLogin(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	enabled, err := h.Services.TwoFactor.Enabled(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	// Whoever was signed in on this browser, including an admin
+	// impersonating them, is signed out before someone else signs in.
+	err = h.Services.Sessions.Delete(r.Context(), h.SessionManager.Token(r.Context()))
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = h.SessionManager.RenewToken(r.Context())
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.SessionManager.Remove(r.Context(), httputil.SessionKeyAuthenticatedUserID)
+	h.SessionManager.Remove(r.Context(), httputil.SessionKeyAuthenticatedAt)
+	h.SessionManager.Remove(r.Context(), httputil.SessionKeyImpersonatorID)
+
+	if enabled {
+		h.SessionManager.Put(r.Context(), httputil.SessionKeyPendingTwoFactorUserID, user.ID)
+		h.SessionManager.Put(r.Context(), httputil.SessionKeyPendingTwoFactorAt, time.Now())
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// completeLogin marks the session as authenticated and sends users whose
+// permissions demand two-factor authentication, but who haven't set it up, to
+// the enrolment page.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyAuthenticatedUserID, user.ID)
+	h.SessionManager.Put(r.Context(), httputil.SessionKeyAuthenticatedAt, time.Now())
+
+	err := h.Services.Sessions.Register(r.Context(), service.RegisterSessionReq{
+		Token:     h.SessionManager.Token(r.Context()),
+		UserID:    user.ID,
+		IP:        httputil.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = h.Services.LoginThrottle.RecordSuccess(r.Context(), user.Email)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	permissions, err := h.Services.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if h.Services.TwoFactor.RequiredFor(permissions) {
+		enabled, err := h.Services.TwoFactor.Enabled(r.Context(), user.ID)
+		if err != nil {
+			httputil.ServerError(h.Logger, w, r, err)
+			return
+		}
+
+		if !enabled {
+			http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (h *Handler) pendingTwoFactorUserID(r *http.Request) int64 {
+	startedAt := h.SessionManager.GetTime(r.Context(), httputil.SessionKeyPendingTwoFactorAt)
+	if time.Since(startedAt) > pendingTwoFactorTTL {
+		return 0
+	}
+
+	return h.SessionManager.GetInt64(r.Context(), httputil.SessionKeyPendingTwoFactorUserID)
+}
+
+// recordLoginFailure counts a failed first or second factor and emails the
+// account owner if the failure locked their account.
+func (h *Handler) recordLoginFailure(r *http.Request, email string) error {
+	locked, err := h.Services.LoginThrottle.RecordFailure(r.Context(), email, httputil.ClientIP(r))
+	if err != nil || !locked {
+		return err
+	}
+
+	lockedUntil := time.Now().Add(h.Services.LoginThrottle.Config.LockoutDuration)
+
+	h.background(r, func(ctx context.Context) {
+		user, err := h.Services.Users.GetByEmail(ctx, email)
+		if err != nil {
+			// Unknown addresses are locked too, but there is no one to tell.
+			if !errors.Is(err, service.ErrRecordNotFound) {
+				h.Logger.ErrorContext(ctx, err.Error())
+			}
+			return
+		}
+
+		data := map[string]any{
+			"name":        user.Name,
+			"lockedUntil": lockedUntil.Format("2006-01-02 15:04 MST"),
+		}
+
+		err = h.sendMail(ctx, user.Email, "user_lockout.tmpl", data)
+		if err != nil {
+			h.Logger.ErrorContext(ctx, err.Error())
+		}
+	})
+
+	return nil
+}
+
+func (h *Handler) renderThrottled(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, page templ.Component) {
+	w.Header().Set("Retry-After", strconv.Itoa(httputil.RetryAfterSeconds(retryAfter)))
+	h.render(w, r, http.StatusTooManyRequests, page)
+}
+
+func throttledMessage(err error, retryAfter time.Duration) string {
+	if errors.Is(err, service.ErrAccountLocked) {
+		return "too many failed attempts, this account is temporarily locked"
+	}
+	return fmt.Sprintf("too many failed attempts, try again in %d seconds", httputil.RetryAfterSeconds(retryAfter))
+}
+
+// activationTokenTTL is how long the token emailed to a new user stays valid.
+const activationTokenTTL = 3 * 24 * time.Hour
+
+type userRes struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Activated bool      `json:"activated"`
+	Version   int32     `json:"version"`
+}
+
+func newUserRes(user domain.User) userRes {
+	return userRes{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		Name:      user.Name,
+		Email:     user.Email,
+		Activated: user.Activated,
+		Version:   user.Version,
+	}
+}
+
+func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	res, err := h.Services.Users.Signup(r.Context(), service.SignupReq{
+		Name:     input.Name,
+		Email:    input.Email,
+		Password: input.Password,
+	})
+	if err != nil {
+		var errs errsx.Map
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		case errors.Is(err, service.ErrDuplicateEmail):
+			errs.Set("email", "a user with this email address already exists")
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	h.Metrics.UsersRegistered.Inc()
+
+	user := domain.User{
+		ID:        res.ID,
+		CreatedAt: res.CreatedAt,
+		Name:      input.Name,
+		Email:     input.Email,
+		Version:   res.Version,
+	}
+
+	token, err := h.Services.Tokens.New(r.Context(), user.ID, activationTokenTTL, domain.ActivationScope)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	h.background(r, func(ctx context.Context) {
+		data := map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+
+		err := h.sendMail(ctx, user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			h.Logger.ErrorContext(ctx, err.Error())
+		}
+	})
+
+	err = httputil.WriteJSON(w, http.StatusAccepted, httputil.Envelope{"user": newUserRes(user)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := httputil.ReadJSON(w, r, &input)
+	if err != nil {
+		httputil.BadRequest(w, r, err)
+		return
+	}
+
+	var errs errsx.Map
+
+	_, err = domain.NewTokenPlaintext(input.Token)
+	if err != nil {
+		errs.Set("token", err)
+		httputil.FailedValidation(h.Logger, w, r, errs)
+		return
+	}
+
+	user, err := h.Services.Users.GetForToken(r.Context(), service.GetForTokenReq{
+		TokenScope:     domain.ActivationScope,
+		TokenPlaintext: input.Token,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			errs.Set("token", "invalid or expired activation token")
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	user.Version, err = h.Services.Users.ActivateUser(r.Context(), service.ActivateUserReq{
+		ID:      user.ID,
+		Version: user.Version,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrEditConflict):
+			httputil.ClientError(w, r, http.StatusConflict)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+	user.Activated = true
+
+	err = h.Services.Tokens.DeleteAllForUser(r.Context(), domain.ActivationScope, user.ID)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"user": newUserRes(*user)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var errs errsx.Map
+
+	req := service.GetAllUsersReq{
+		Query: httputil.ReadString(qs, "q", ""),
+		Filters: service.Filters{
+			Page:         httputil.ReadInt(qs, "page", 1, &errs),
+			PageSize:     httputil.ReadInt(qs, "page_size", 20, &errs),
+			Sort:         httputil.ReadString(qs, "sort", "id"),
+			SortSafeList: []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"},
+		},
+	}
+
+	if errs != nil {
+		httputil.FailedValidation(h.Logger, w, r, errs)
+		return
+	}
+
+	users, metadata, err := h.Services.Users.GetAll(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.As(err, &errs):
+			httputil.FailedValidation(h.Logger, w, r, errs)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	res := make([]userRes, len(users))
+	for i := range users {
+		res[i] = newUserRes(users[i])
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"users": res, "metadata": metadata}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
+
+// ShowUser shows a user to themselves or to holders of users:read. Other
+// users are reported as missing so their IDs can't be probed.
+func (h *Handler) ShowUser(w http.ResponseWriter, r *http.Request) {
+	id, err := httputil.ReadIDParam(r)
+	if err != nil {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	principal, err := h.principal(r)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+		return
+	}
+
+	if principal.User.ID != id && !principal.Has(domain.PermissionUsersRead) {
+		httputil.NotFoundError(w, r)
+		return
+	}
+
+	user, err := h.Services.Users.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.NotFoundError(w, r)
+		default:
+			httputil.ServerError(h.Logger, w, r, err)
+		}
+		return
+	}
+
+	err = httputil.WriteJSON(w, http.StatusOK, httputil.Envelope{"user": newUserRes(*user)}, nil)
+	if err != nil {
+		httputil.ServerError(h.Logger, w, r, err)
+	}
+}
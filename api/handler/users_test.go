@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/internal/testdb"
+)
+
+func newTestHandler(t *testing.T) (*Handler, *sql.DB) {
+	t.Helper()
+
+	db := testdb.New(t)
+
+	h := &Handler{
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Services:       service.NewServices(db, service.Config{}),
+		SessionManager: scs.New(),
+	}
+
+	return h, db
+}
+
+func insertUser(t *testing.T, db *sql.DB, email string) int64 {
+	t.Helper()
+
+	var id int64
+	err := db.QueryRowContext(context.Background(), `
+        INSERT INTO users (name, email, password_hash, activated)
+        VALUES ('Test user', $1, '\x00', true)
+        RETURNING id`, email).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// serve runs next inside the session manager with the given session cookie,
+// if any, and returns the cookie the response leaves behind.
+func serve(t *testing.T, sm *scs.SessionManager, cookie *http.Cookie, next http.HandlerFunc) *http.Cookie {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+
+	sm.LoadAndSave(next).ServeHTTP(w, r)
+
+	if w.Code >= 500 {
+		t.Fatalf("status = %d, want no server error", w.Code)
+	}
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sm.Cookie.Name {
+			return c
+		}
+	}
+
+	return cookie
+}
+
+// impersonatingSession returns the cookie of a session in which adminID is
+// impersonating customerID.
+func impersonatingSession(t *testing.T, sm *scs.SessionManager, adminID, customerID int64) *http.Cookie {
+	t.Helper()
+
+	return serve(t, sm, nil, func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), httputil.SessionKeyAuthenticatedUserID, customerID)
+		sm.Put(r.Context(), httputil.SessionKeyImpersonatorID, adminID)
+	})
+}
+
+func TestLogoutEndsImpersonation(t *testing.T) {
+	h, db := newTestHandler(t)
+	sm := h.SessionManager
+
+	adminID := insertUser(t, db, "admin@example.com")
+	customerID := insertUser(t, db, "customer@example.com")
+
+	cookie := impersonatingSession(t, sm, adminID, customerID)
+
+	serve(t, sm, cookie, h.LogoutPost)
+
+	// Even replaying the old cookie finds nothing of the admin behind it.
+	serve(t, sm, cookie, func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range []string{httputil.SessionKeyAuthenticatedUserID, httputil.SessionKeyImpersonatorID} {
+			if sm.Exists(r.Context(), key) {
+				t.Errorf("%s survived logout", key)
+			}
+		}
+	})
+}
+
+func TestLoginEndsImpersonation(t *testing.T) {
+	h, db := newTestHandler(t)
+	sm := h.SessionManager
+
+	adminID := insertUser(t, db, "admin@example.com")
+	customerID := insertUser(t, db, "customer@example.com")
+	otherID := insertUser(t, db, "other@example.com")
+
+	other, err := h.Services.Users.GetByID(context.Background(), otherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := impersonatingSession(t, sm, adminID, customerID)
+
+	cookie = serve(t, sm, cookie, func(w http.ResponseWriter, r *http.Request) {
+		h.startLogin(w, r, other)
+	})
+
+	serve(t, sm, cookie, func(w http.ResponseWriter, r *http.Request) {
+		if got := sm.GetInt64(r.Context(), httputil.SessionKeyAuthenticatedUserID); got != otherID {
+			t.Errorf("signed in as %d, want %d", got, otherID)
+		}
+		if sm.Exists(r.Context(), httputil.SessionKeyImpersonatorID) {
+			t.Error("impersonator carried over into the new login")
+		}
+	})
+}
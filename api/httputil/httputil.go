@@ -1,17 +1,44 @@
 package httputil
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ruhollahh/paperback/api/contextutil"
 	"github.com/ruhollahh/paperback/internal/app/service"
 
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ruhollahh/paperback/pkg/errsx"
 )
 
+const (
+	SessionKeyAuthenticatedUserID    = "authenticatedUserID"
+	SessionKeyAuthenticatedAt        = "authenticatedAt"
+	SessionKeyPendingTwoFactorUserID = "pendingTwoFactorUserID"
+	SessionKeyPendingTwoFactorAt     = "pendingTwoFactorAt"
+	SessionKeyOIDCProvider           = "oidcProvider"
+	SessionKeyOIDCState              = "oidcState"
+	SessionKeyOIDCNonce              = "oidcNonce"
+	SessionKeyOIDCCodeVerifier       = "oidcCodeVerifier"
+	// SessionKeyImpersonatorID holds the admin's own user ID while they are
+	// signed in as someone else.
+	SessionKeyImpersonatorID = "impersonatorID"
+)
+
+type Envelope map[string]any
+
 func LogError(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
 	var (
 		method = r.Method
@@ -19,20 +46,208 @@ func LogError(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err e
 		trace  = string(debug.Stack())
 	)
 
-	logger.Error(err.Error(), "uri", uri, "method", method, "trace", trace)
+	logger.ErrorContext(r.Context(), err.Error(), "uri", uri, "method", method, "trace", trace)
 }
 
 func ServerError(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
 	LogError(logger, w, r, err)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	ErrorResponse(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+// ErrorResponse writes message with status, as an {"error": message} envelope
+// when the client accepts JSON and as plain text otherwise.
+func ErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if !AcceptsJSON(r) {
+		http.Error(w, message, status)
+		return
+	}
+
+	err := WriteJSON(w, status, Envelope{"error": message}, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// AcceptsJSON reports whether the request's Accept header lists JSON.
+func AcceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
+	ErrorResponse(w, r, status, http.StatusText(status))
+}
+
+// BadRequest reports a request the server couldn't make sense of, such as
+// malformed JSON, with err's message for the client.
+func BadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
+// RateLimitExceeded tells the client to slow down and when to try again.
+func RateLimitExceeded(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(retryAfter)))
+	ClientError(w, r, http.StatusTooManyRequests)
+}
+
+// RetryAfterSeconds rounds d up to whole seconds for a Retry-After header.
+func RetryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func NotFoundError(w http.ResponseWriter, r *http.Request) {
+	ClientError(w, r, http.StatusNotFound)
+}
+
+func AuthenticationRequired(w http.ResponseWriter, r *http.Request) {
+	ErrorResponse(w, r, http.StatusUnauthorized, "you must be authenticated to access this resource")
+}
+
+func InvalidAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	ErrorResponse(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+}
+
+// TwoFactorRequired refuses an action whose permission requires the user to
+// have two-factor authentication enabled first.
+func TwoFactorRequired(w http.ResponseWriter, r *http.Request) {
+	ErrorResponse(w, r, http.StatusForbidden, "two-factor authentication must be enabled to perform this action")
+}
+
+func FailedValidation(logger *slog.Logger, w http.ResponseWriter, r *http.Request, errs errsx.Map) {
+	err := WriteJSON(w, http.StatusUnprocessableEntity, Envelope{"errors": errs}, nil)
+	if err != nil {
+		LogError(logger, w, r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func WriteJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
+	jsonData, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	jsonData = append(jsonData, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_, err = w.Write(jsonData)
+	return err
+}
+
+// maxJSONBodyBytes caps the size of a JSON request body.
+const maxJSONBodyBytes = 1_048_576
+
+// ReadJSON decodes a request body holding exactly one JSON value into dst.
+// Unknown fields are rejected, and the errors it returns are worded for the
+// client, ready to be passed to BadRequest.
+func ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+
+		case errors.As(err, &invalidUnmarshalError):
+			panic(err)
+
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+func ReadIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+func ReadString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
 }
 
-func ClientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+func ReadInt(qs url.Values, key string, defaultValue int, errs *errsx.Map) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		errs.Set(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
 }
 
-func NotFoundError(w http.ResponseWriter) {
-	ClientError(w, http.StatusNotFound)
+// ClientIP returns the address of the client that sent the request.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
 }
 
 func DecodePostForm(formDecoder *form.Decoder, r *http.Request, dst any) error {
@@ -0,0 +1,123 @@
+// Package metrics exposes Paperback's operational and business metrics in
+// the Prometheus format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "paperback"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	mailsSent       *prometheus.CounterVec
+
+	// BackgroundTasks counts the tasks the API is running outside a request,
+	// which are the ones shutdown waits for.
+	BackgroundTasks prometheus.Gauge
+	OrdersPlaced    prometheus.Counter
+	OrdersCancelled prometheus.Counter
+	UsersRegistered prometheus.Counter
+}
+
+// New registers the metrics, along with Go runtime, process and db pool
+// statistics, on a registry of their own.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		mailsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "mails_sent_total",
+			Help:      "Emails sent, by template and result.",
+		}, []string{"template", "result"}),
+		BackgroundTasks: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "background_tasks",
+			Help:      "Background tasks currently running.",
+		}),
+		OrdersPlaced: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "orders_placed_total",
+			Help:      "Orders placed.",
+		}),
+		OrdersCancelled: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "orders_cancelled_total",
+			Help:      "Orders cancelled.",
+		}),
+		UsersRegistered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_registered_total",
+			Help:      "Users registered.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, namespace),
+		m.requests,
+		m.requestDuration,
+		m.mailsSent,
+		m.BackgroundTasks,
+		m.OrdersPlaced,
+		m.OrdersCancelled,
+		m.UsersRegistered,
+	)
+
+	return m
+}
+
+// ObserveRequest records a handled request. route is the pattern the router
+// matched rather than the path, and unknown methods are lumped together, so
+// clients can't create series at will.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		method = "other"
+	}
+
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// ObserveMail records an attempt to send an email from template.
+func (m *Metrics) ObserveMail(template string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	m.mailsSent.WithLabelValues(template, result).Inc()
+}
+
+// Handler serves the metrics for scraping.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
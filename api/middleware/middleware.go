@@ -9,10 +9,14 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"strings"
+	"time"
 
+	"github.com/ruhollahh/paperback/api/config"
 	"github.com/ruhollahh/paperback/api/contextutil"
 	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/api/metrics"
 	"github.com/ruhollahh/paperback/internal/app/service"
 
 	"github.com/alexedwards/scs/v2"
@@ -25,6 +29,10 @@ type Middleware struct {
 	Services       service.Services
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
+	Limiter        config.LimiterConfig
+	TrustedProxies []netip.Prefix
+	TrustedOrigins []string
+	Metrics        *metrics.Metrics
 }
 
 func (m *Middleware) SecureHeaders(next http.Handler) http.Handler {
@@ -41,26 +49,66 @@ func (m *Middleware) SecureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// LogRequest writes an access log line and records the request's metrics
+// once it has been handled. A request whose handler panicked is logged as the
+// 500 that RecoverPanic, further out, turns it into.
 func (m *Middleware) LogRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var (
-			ip     = r.RemoteAddr
-			proto  = r.Proto
-			method = r.Method
-			uri    = r.URL.RequestURI()
-		)
+		start := time.Now()
 
-		m.Logger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+		entry := &contextutil.RequestLog{}
+		r = r.WithContext(contextutil.ContextSetRequestLog(r.Context(), entry))
 
-		next.ServeHTTP(w, r)
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		completed := false
+		defer func() {
+			if !completed {
+				rec.status = http.StatusInternalServerError
+			}
+
+			duration := time.Since(start)
+
+			m.Logger.InfoContext(r.Context(), "completed request",
+				"ip", httputil.ClientIP(r),
+				"proto", r.Proto,
+				"method", r.Method,
+				"uri", r.URL.RequestURI(),
+				"route", entry.Route,
+				"status", rec.status,
+				"bytes", rec.bytes,
+				"duration", duration,
+				"user_id", entry.UserID,
+			)
+
+			m.Metrics.ObserveRequest(entry.Route, r.Method, rec.status, duration)
+		}()
+
+		next.ServeHTTP(rec, r)
+		completed = true
 	})
 }
 
+// loggedPanic carries a panic that LogPanic has already logged on to
+// RecoverPanic.
+type loggedPanic struct {
+	value any
+}
+
+// RecoverPanic turns a panic into a 500. It comes first in the chain so that
+// a panic in the other middleware is caught too; a panic LogPanic has already
+// logged with the request's ID and trace isn't logged again.
 func (m *Middleware) RecoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
+
+				if _, ok := err.(loggedPanic); ok {
+					httputil.ClientError(w, r, http.StatusInternalServerError)
+					return
+				}
+
 				httputil.ServerError(m.Logger, w, r, fmt.Errorf("%s", err))
 			}
 		}()
@@ -69,15 +117,38 @@ func (m *Middleware) RecoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// LogPanic logs a panic with the request's context, so the log line carries
+// its request ID and trace, and passes it on to RecoverPanic. It goes after
+// RequestID and Trace.
+func (m *Middleware) LogPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				httputil.LogError(m.Logger, w, r, fmt.Errorf("%s", err))
+				panic(loggedPanic{value: err})
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := m.SessionManager.GetInt64(r.Context(), "authenticatedUserID")
+		w.Header().Add("Vary", "Authorization")
+
+		if r.Header.Get("Authorization") != "" {
+			m.authenticateAccessToken(next, w, r)
+			return
+		}
+
+		id := m.SessionManager.GetInt64(r.Context(), httputil.SessionKeyAuthenticatedUserID)
 		var ctx context.Context
 		if id == 0 {
 			ctx = contextutil.ContextSetUser(r.Context(), service.AnonymousUser)
 		}
 
-		user, err := m.Services.Users.GetByID(id)
+		user, err := m.Services.Users.GetByID(r.Context(), id)
 		if err != nil {
 			switch {
 			case errors.Is(err, service.ErrRecordNotFound):
@@ -88,6 +159,21 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 			}
 		} else {
 			ctx = contextutil.ContextSetUser(r.Context(), user)
+
+			impersonatorID := m.SessionManager.GetInt64(r.Context(), httputil.SessionKeyImpersonatorID)
+			if impersonatorID != 0 {
+				impersonator, err := m.Services.Users.GetByID(r.Context(), impersonatorID)
+				switch {
+				case err == nil:
+					ctx = contextutil.ContextSetImpersonator(ctx, impersonator)
+				case errors.Is(err, service.ErrRecordNotFound):
+					// The admin is gone, and with them any way back.
+					m.SessionManager.Remove(r.Context(), httputil.SessionKeyImpersonatorID)
+				default:
+					httputil.ServerError(m.Logger, w, r, err)
+					return
+				}
+			}
 		}
 
 		r = r.WithContext(ctx)
@@ -96,11 +182,74 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+func (m *Middleware) authenticateAccessToken(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	headerParts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		httputil.InvalidAuthenticationToken(w, r)
+		return
+	}
+
+	user, token, err := m.Services.PersonalAccessTokens.Authenticate(r.Context(), headerParts[1])
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRecordNotFound):
+			httputil.InvalidAuthenticationToken(w, r)
+		default:
+			httputil.ServerError(m.Logger, w, r, err)
+		}
+		return
+	}
+
+	ctx := contextutil.ContextSetUser(r.Context(), user)
+	ctx = contextutil.ContextSetAccessToken(ctx, token)
+	r = r.WithContext(ctx)
+
+	next.ServeHTTP(w, r)
+}
+
+// TrackSession records activity on the session of a signed-in user so the
+// sessions page can show when each device was last seen. A session missing
+// from the index, such as one signed in before the index existed, could never
+// be listed or revoked, so it is ended instead.
+func (m *Middleware) TrackSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := contextutil.ContextGetUser(r.Context())
+
+		if !service.IsAnonymous(user) && contextutil.ContextGetAccessToken(r.Context()) == nil {
+			indexed, err := m.Services.Sessions.Touch(r.Context(), m.SessionManager.Token(r.Context()), httputil.ClientIP(r))
+			if err != nil {
+				httputil.ServerError(m.Logger, w, r, err)
+				return
+			}
+
+			if !indexed {
+				err = m.SessionManager.Destroy(r.Context())
+				if err != nil {
+					httputil.ServerError(m.Logger, w, r, err)
+					return
+				}
+
+				ctx := contextutil.ContextSetUser(r.Context(), service.AnonymousUser)
+				ctx = contextutil.ContextSetImpersonator(ctx, nil)
+				r = r.WithContext(ctx)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (m *Middleware) RequireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := contextutil.ContextGetUser(r.Context())
 
 		if service.IsAnonymous(user) {
+			// API clients can't follow a redirect to a sign-in page.
+			if httputil.AcceptsJSON(r) {
+				httputil.AuthenticationRequired(w, r)
+				return
+			}
+
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
@@ -115,7 +264,7 @@ func (m *Middleware) RequireActivatedUser(next http.HandlerFunc) http.HandlerFun
 		user := contextutil.ContextGetUser(r.Context())
 
 		if !user.Activated {
-			httputil.ClientError(w, http.StatusForbidden)
+			httputil.ClientError(w, r, http.StatusForbidden)
 			return
 		}
 
@@ -129,14 +278,30 @@ func (m *Middleware) RequirePermission(code string, next http.HandlerFunc) http.
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := contextutil.ContextGetUser(r.Context())
 
-		permissions, err := m.Services.Permissions.GetAllForUser(user.ID)
-		if err != nil {
-			httputil.ServerError(m.Logger, w, r, err)
-			return
+		permissions, ok := contextutil.ContextGetPermissions(r.Context())
+		if !ok {
+			var err error
+			permissions, err = m.Services.Permissions.GetAllForUser(r.Context(), user.ID)
+			if err != nil {
+				httputil.ServerError(m.Logger, w, r, err)
+				return
+			}
+
+			r = r.WithContext(contextutil.ContextSetPermissions(r.Context(), permissions))
 		}
 
 		if !service.PermissionsInclude(permissions, code) {
-			httputil.ClientError(w, http.StatusForbidden)
+			httputil.ClientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		token := contextutil.ContextGetAccessToken(r.Context())
+		if token != nil && !service.PermissionsInclude(token.Permissions, code) {
+			httputil.ClientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		if m.Services.TwoFactor.RequiredForPermission(code) && !m.checkTwoFactor(w, r, user.ID) {
 			return
 		}
 
@@ -146,13 +311,63 @@ func (m *Middleware) RequirePermission(code string, next http.HandlerFunc) http.
 	return m.RequireActivatedUser(fn)
 }
 
+// checkTwoFactor reports whether the user has confirmed two-factor
+// authentication. When they haven't, it has already responded: a browser is
+// sent to enrol, while API clients and personal access tokens get a 403,
+// since a token must not become a way around the requirement.
+func (m *Middleware) checkTwoFactor(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	enabled, err := m.Services.TwoFactor.Enabled(r.Context(), userID)
+	if err != nil {
+		httputil.ServerError(m.Logger, w, r, err)
+		return false
+	}
+
+	if !enabled {
+		if contextutil.ContextGetAccessToken(r.Context()) != nil || httputil.AcceptsJSON(r) {
+			httputil.TwoFactorRequired(w, r)
+			return false
+		}
+
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return false
+	}
+
+	return true
+}
+
+// BlockWhileImpersonating refuses actions an admin must not take on a
+// customer's behalf, such as changing their credentials, paying or editing
+// what they have bought or written. Impersonation is for seeing what the
+// customer sees.
+func (m *Middleware) BlockWhileImpersonating(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contextutil.ContextGetImpersonator(r.Context()) != nil {
+			httputil.ClientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
 func (m *Middleware) CSRF(next http.Handler) http.Handler {
-	handler := nosurf.New(next)
+	handler := nosurf.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := contextutil.ContextSetCSRFToken(r.Context(), nosurf.Token(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	handler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httputil.ErrorResponse(w, r, http.StatusBadRequest, "missing or invalid CSRF token")
+	}))
 	handler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/",
 		Secure:   true,
 	})
+	// Requests carrying a bearer token don't rely on cookies, so there is
+	// nothing for a cross-site request to forge.
+	handler.ExemptFunc(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") != ""
+	})
 	return handler
 }
 
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/app/service"
+	"github.com/ruhollahh/paperback/internal/testdb"
+)
+
+func TestAuthenticateDropsMissingImpersonator(t *testing.T) {
+	ctx := context.Background()
+
+	db := testdb.New(t)
+	sm := scs.New()
+	m := &Middleware{
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Services:       service.NewServices(db, service.Config{}),
+		SessionManager: sm,
+	}
+
+	var adminID, customerID int64
+	for _, u := range []struct {
+		email string
+		id    *int64
+	}{{"admin@example.com", &adminID}, {"customer@example.com", &customerID}} {
+		err := db.QueryRowContext(ctx, `
+            INSERT INTO users (name, email, password_hash, activated)
+            VALUES ('Test user', $1, '\x00', true)
+            RETURNING id`, u.email).Scan(u.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cookie *http.Cookie
+	serve := func(next http.HandlerFunc) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+
+		sm.LoadAndSave(m.Authenticate(next)).ServeHTTP(w, r)
+
+		for _, c := range w.Result().Cookies() {
+			if c.Name == sm.Cookie.Name {
+				cookie = c
+			}
+		}
+		return w.Code
+	}
+
+	serve(func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), httputil.SessionKeyAuthenticatedUserID, customerID)
+		sm.Put(r.Context(), httputil.SessionKeyImpersonatorID, adminID)
+	})
+
+	_, err := db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := serve(func(w http.ResponseWriter, r *http.Request) {
+		if user := contextutil.ContextGetUser(r.Context()); user.ID != customerID {
+			t.Errorf("user = %d, want %d", user.ID, customerID)
+		}
+		if impersonator := contextutil.ContextGetImpersonator(r.Context()); impersonator != nil {
+			t.Errorf("impersonator = %d, want none", impersonator.ID)
+		}
+	})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+
+	serve(func(w http.ResponseWriter, r *http.Request) {
+		if sm.Exists(r.Context(), httputil.SessionKeyImpersonatorID) {
+			t.Error("missing impersonator was kept in the session")
+		}
+	})
+}
+
+func TestPanicIsLoggedWithRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	m := &Middleware{
+		Logger: slog.New(contextutil.NewLogHandler(slog.NewJSONHandler(&buf, nil))),
+	}
+
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	m.RecoverPanic(m.RequestID(m.LogPanic(panicking))).ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	var lines []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var record map[string]any
+		err := json.Unmarshal(line, &record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, record)
+	}
+
+	if len(lines) != 1 {
+		t.Fatalf("panic logged %d times, want once", len(lines))
+	}
+
+	want := w.Header().Get(requestIDHeader)
+	if got := lines[0]["request_id"]; got != want || want == "" {
+		t.Errorf("request_id = %v, want %q", got, want)
+	}
+	if got := lines[0]["msg"]; got != "boom" {
+		t.Errorf("msg = %v, want boom", got)
+	}
+}
+
+func TestPanicOutsideLogPanicIsStillLogged(t *testing.T) {
+	var buf bytes.Buffer
+	m := &Middleware{
+		Logger: slog.New(slog.NewTextHandler(&buf, nil)),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	m.RecoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})).ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("msg=boom")) {
+		t.Errorf("log = %q, want the panic", buf.String())
+	}
+}
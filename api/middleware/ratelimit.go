@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruhollahh/paperback/api/httputil"
+
+	"golang.org/x/time/rate"
+)
+
+// RealIP replaces the request's remote address with the client's when the
+// request came through one of the trusted proxies. X-Forwarded-For is read
+// from the right, skipping trusted hops, so a client can't pose as another
+// by sending the header itself.
+func (m *Middleware) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(m.TrustedProxies) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		peer, err := netip.ParseAddr(httputil.ClientIP(r))
+		if err != nil || !m.trustedProxy(peer) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+
+			if i == 0 || !m.trustedProxy(addr) {
+				r.RemoteAddr = net.JoinHostPort(addr.Unmap().String(), "0")
+				break
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *Middleware) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range m.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	rateLimitSweepInterval = time.Minute
+	rateLimitIdleTimeout   = 3 * time.Minute
+)
+
+type rateLimitClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps a token bucket per client IP. Clients that go quiet are
+// forgotten so the map doesn't grow without bound; the sweep runs as part of
+// allow, so there is no goroutine to stop when the server shuts down.
+type rateLimiter struct {
+	rps   rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*rateLimitClient
+	lastSweep time.Time
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rps:       rate.Limit(rps),
+		burst:     max(burst, 1),
+		clients:   make(map[string]*rateLimitClient),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from ip's bucket. When none is left it returns how
+// long until one will be.
+func (l *rateLimiter) allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.evictIdle(now.Add(-rateLimitIdleTimeout))
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &rateLimitClient{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+
+	reservation := c.limiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return true, 0
+	}
+
+	reservation.Cancel()
+	return false, delay
+}
+
+// evictIdle forgets clients not seen since before. l.mu must be held.
+func (l *rateLimiter) evictIdle(before time.Time) {
+	for ip, c := range l.clients {
+		if c.lastSeen.Before(before) {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// RateLimit returns middleware allowing each client rps requests a second,
+// with bursts of up to burst. Every call gets its own buckets, so a route can
+// be given a stricter limit on top of the global one.
+func (m *Middleware) RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
+	if !m.Limiter.Enabled {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	limiter := newRateLimiter(rps, burst)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retryAfter := limiter.allow(httputil.ClientIP(r))
+			if !ok {
+				httputil.RateLimitExceeded(w, r, retryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
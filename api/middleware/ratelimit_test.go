@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterForgetsIdleClients(t *testing.T) {
+	l := newRateLimiter(1, 1)
+
+	if ok, _ := l.allow("192.0.2.1"); !ok {
+		t.Fatal("first request refused")
+	}
+	if ok, _ := l.allow("192.0.2.1"); ok {
+		t.Fatal("request over the burst allowed")
+	}
+
+	// The client goes quiet for longer than the idle timeout, and the next
+	// sweep is due.
+	l.clients["192.0.2.1"].lastSeen = time.Now().Add(-rateLimitIdleTimeout - time.Second)
+	l.lastSweep = time.Now().Add(-rateLimitSweepInterval)
+
+	if ok, _ := l.allow("192.0.2.2"); !ok {
+		t.Fatal("another client's first request refused")
+	}
+
+	if _, ok := l.clients["192.0.2.1"]; ok {
+		t.Error("idle client was not forgotten")
+	}
+	if _, ok := l.clients["192.0.2.2"]; !ok {
+		t.Error("active client was forgotten")
+	}
+}
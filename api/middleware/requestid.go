@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestID tags the request with the ID a proxy in front of us forwarded, or
+// a new one, and echoes it back so clients can quote it in bug reports.
+func (m *Middleware) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+
+		r = r.WithContext(contextutil.ContextSetRequestID(r.Context(), id))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	var buf [16]byte
+
+	_, err := io.ReadFull(rand.Reader, buf[:])
+	if err != nil {
+		panic("request ID rand.Reader failed: " + err.Error())
+	}
+
+	return hex.EncodeToString(buf[:])
+}
+
+// validRequestID keeps forwarded IDs short and free of anything that could
+// forge log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// responseRecorder notes the status and size of a response for the access
+// log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
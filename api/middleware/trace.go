@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/httputil"
+	"github.com/ruhollahh/paperback/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace wraps the request in a server span, continuing the trace of a caller
+// that sent a traceparent header. The router renames the span after the route
+// it matches.
+func (m *Middleware) Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(httputil.ClientIP(r)),
+				attribute.String("http.request_id", contextutil.ContextGetRequestID(r.Context())),
+			),
+		)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		// A panicking handler ends as a 500 once RecoverPanic, further out,
+		// has caught it.
+		completed := false
+		defer func() {
+			if !completed {
+				rec.status = http.StatusInternalServerError
+			}
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+			span.End()
+		}()
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		completed = true
+	})
+}
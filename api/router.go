@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/docs"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// routeRecorder records the routes registered with it so they can be checked
+// against the OpenAPI document.
+type routeRecorder struct {
+	*httprouter.Router
+	routes []docs.Route
+}
+
+// Handler also notes the route on the request's log entry and span, so the
+// access log, metrics and traces can group requests by route instead of by
+// path.
+func (r *routeRecorder) Handler(method, path string, handler http.Handler) {
+	r.routes = append(r.routes, docs.Route{Method: method, Path: path})
+	r.Router.Handler(method, path, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if entry := contextutil.ContextGetRequestLog(req.Context()); entry != nil {
+			entry.Route = path
+		}
+
+		span := trace.SpanFromContext(req.Context())
+		span.SetName(method + " " + path)
+		span.SetAttributes(semconv.HTTPRoute(path))
+
+		handler.ServeHTTP(w, req)
+	}))
+}
+
+func (r *routeRecorder) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.Handler(method, path, handler)
+}
+
+// apiRoutes returns the recorded routes that belong to the /v1 API.
+func (r *routeRecorder) apiRoutes() []docs.Route {
+	var routes []docs.Route
+
+	for _, route := range r.routes {
+		if strings.HasPrefix(route.Path, "/v1/") {
+			routes = append(routes, route)
+		}
+	}
+
+	return routes
+}
@@ -6,21 +6,58 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 	"github.com/ruhollahh/paperback/api/config"
+	"github.com/ruhollahh/paperback/api/docs"
 	"github.com/ruhollahh/paperback/api/handler"
 	"github.com/ruhollahh/paperback/api/middleware"
+	"github.com/ruhollahh/paperback/internal/app/domain"
 )
 
 func (a *API) routes() http.Handler {
-	router := httprouter.New()
+	router, middleware := a.router()
+
+	// RecoverPanic comes first so a panic anywhere, including in the other
+	// middleware, still ends in a 500 rather than a dropped connection.
+	// LogPanic sits inside RequestID and Trace so the panic is logged with
+	// both.
+	standard := alice.New(
+		middleware.RecoverPanic,
+		middleware.RequestID,
+		middleware.RealIP,
+		middleware.Trace,
+		middleware.LogRequest,
+		middleware.LogPanic,
+		middleware.SecureHeaders,
+		middleware.EnableCORS,
+		middleware.RateLimit(a.Config.Limiter.Rps, a.Config.Limiter.Burst),
+	)
+	return standard.Then(router)
+}
+
+// router registers every route. The middleware the routes were built with is
+// returned too, for the chain wrapped around the whole router.
+func (a *API) router() (*routeRecorder, *middleware.Middleware) {
+	// The document is embedded, so failing to parse it is a build mistake.
+	apiDocs, err := docs.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	router := &routeRecorder{Router: httprouter.New()}
 
 	handler := &handler.Handler{
-		Router:         router,
+		Router:         router.Router,
 		Config:         a.Config,
 		Version:        config.Version,
 		Logger:         a.Logger,
 		Services:       a.Services,
 		FormDecoder:    a.FormDecoder,
 		SessionManager: a.SessionManager,
+		OIDC:           a.OIDC,
+		Mailer:         a.Mailer,
+		Wg:             &a.Wg,
+		APIDocs:        apiDocs,
+		Metrics:        a.Metrics,
+		Draining:       &a.draining,
 	}
 
 	middleware := &middleware.Middleware{
@@ -28,6 +65,10 @@ func (a *API) routes() http.Handler {
 		Services:       a.Services,
 		FormDecoder:    a.FormDecoder,
 		SessionManager: a.SessionManager,
+		Limiter:        a.Config.Limiter,
+		TrustedProxies: a.Config.TrustedProxies,
+		TrustedOrigins: a.Config.Cors.TrustedOrigins,
+		Metrics:        a.Metrics,
 	}
 
 	// fileServer := http.FileServer(http.FS(web.Files))
@@ -35,15 +76,99 @@ func (a *API) routes() http.Handler {
 	fileServer := http.FileServer(http.Dir("./web/static/"))
 	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
 
-	dynamic := alice.New(a.SessionManager.LoadAndSave, middleware.CSRF, middleware.Authenticate)
+	dynamic := alice.New(a.SessionManager.LoadAndSave, middleware.CSRF, middleware.Authenticate, middleware.TrackSession)
 	// protected := dynamic.Append(app.requireAuth)
 
+	// sensitive endpoints share a stricter limit on top of the global one.
+	sensitive := alice.New(middleware.RateLimit(a.Config.Limiter.Login.Rps, a.Config.Limiter.Login.Burst))
+	signIn := sensitive.Extend(dynamic)
+
 	router.HandlerFunc(http.MethodGet, "/healthcheck", handler.HealthCheck)
+	router.HandlerFunc(http.MethodGet, "/healthcheck/live", handler.Liveness)
+	router.HandlerFunc(http.MethodGet, "/healthcheck/ready", handler.HealthCheck)
 
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(handler.Home))
 
+	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(handler.Login))
+	router.Handler(http.MethodPost, "/user/login", signIn.ThenFunc(handler.LoginPost))
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamic.ThenFunc(handler.LoginTwoFactor))
+	router.Handler(http.MethodPost, "/user/login/2fa", signIn.ThenFunc(handler.LoginTwoFactorPost))
+	router.Handler(http.MethodGet, "/user/login/oidc/:provider", dynamic.ThenFunc(handler.LoginOIDC))
+	router.Handler(http.MethodGet, "/user/login/oidc/:provider/callback", dynamic.ThenFunc(handler.LoginOIDCCallback))
+	router.Handler(http.MethodPost, "/user/logout", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.LogoutPost)))
+
+	router.Handler(http.MethodGet, "/user/2fa", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.TwoFactorSettings)))
+	router.Handler(http.MethodPost, "/user/2fa/enroll", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.TwoFactorEnrollPost))))
+	router.Handler(http.MethodPost, "/user/2fa/confirm", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.TwoFactorConfirmPost))))
+	router.Handler(http.MethodPost, "/user/2fa/recovery-codes", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.TwoFactorRecoveryCodesPost))))
+	router.Handler(http.MethodPost, "/user/2fa/disable", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.TwoFactorDisablePost))))
+
+	router.Handler(http.MethodPost, "/users/:id/impersonate", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionUsersImpersonate, handler.ImpersonateUserPost)))
+	router.Handler(http.MethodPost, "/user/impersonate/stop", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.StopImpersonationPost)))
+
+	router.Handler(http.MethodGet, "/user/settings", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.Settings)))
+	router.Handler(http.MethodPost, "/user/settings/profile", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.SettingsProfilePost)))
+	router.Handler(http.MethodPost, "/user/settings/password", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.SettingsPasswordPost))))
+
+	router.Handler(http.MethodGet, "/user/account", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.Account)))
+	router.Handler(http.MethodGet, "/user/account/export", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.AccountExport)))
+	router.Handler(http.MethodPost, "/user/account/delete", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.AccountDeletePost))))
+
+	router.Handler(http.MethodGet, "/user/sessions", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(handler.Sessions)))
+	router.Handler(http.MethodPost, "/user/sessions/revoke/:id", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.RevokeSessionPost))))
+	router.Handler(http.MethodPost, "/user/sessions/revoke-others", dynamic.ThenFunc(middleware.RequireAuthenticatedUser(middleware.BlockWhileImpersonating(handler.RevokeOtherSessionsPost))))
+
+	router.Handler(http.MethodGet, "/docs", dynamic.ThenFunc(handler.Docs))
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", handler.OpenAPISpec)
+
+	router.HandlerFunc(http.MethodGet, "/v1/products", handler.ListProducts)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id", handler.ShowProduct)
+
+	router.Handler(http.MethodPost, "/v1/users", sensitive.ThenFunc(handler.RegisterUser))
+	router.Handler(http.MethodPut, "/v1/users/activated", sensitive.ThenFunc(handler.ActivateUser))
+	router.Handler(http.MethodPost, "/v1/tokens/activation", sensitive.ThenFunc(handler.CreateActivationToken))
+
+	router.Handler(http.MethodGet, "/v1/users", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionUsersRead, handler.ListUsers)))
+	router.Handler(http.MethodGet, "/v1/users/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(handler.ShowUser)))
+	router.Handler(http.MethodPost, "/v1/users/:id/unlock", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionUsersWrite, handler.UnlockUser)))
+
+	router.Handler(http.MethodGet, "/v1/audit-events", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionAuditRead, handler.ListAuditEvents)))
+
+	router.Handler(http.MethodGet, "/v1/permissions", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.ListPermissions)))
+	router.Handler(http.MethodGet, "/v1/permissions/:code/users", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.ListPermissionUsers)))
+	router.Handler(http.MethodGet, "/v1/roles", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.ListRoles)))
+	router.Handler(http.MethodGet, "/v1/users/:id/permissions", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.ShowUserPermissions)))
+	router.Handler(http.MethodPost, "/v1/users/:id/permissions", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.GrantUserPermissions)))
+	router.Handler(http.MethodDelete, "/v1/users/:id/permissions/:code", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.RevokeUserPermission)))
+	router.Handler(http.MethodPost, "/v1/users/:id/roles", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.GrantUserRoles)))
+	router.Handler(http.MethodDelete, "/v1/users/:id/roles/:role", dynamic.ThenFunc(middleware.RequirePermission(domain.PermissionPermissionsManage, handler.RevokeUserRole)))
+
+	router.Handler(http.MethodPost, "/v1/products", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.CreateProduct))))
+	router.Handler(http.MethodPatch, "/v1/products/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.UpdateProduct))))
+	router.Handler(http.MethodDelete, "/v1/products/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.DeleteProduct))))
+	router.Handler(http.MethodPost, "/v1/products/:id/reviews", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.CreateReview))))
+	router.Handler(http.MethodPatch, "/v1/reviews/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.UpdateReview))))
+	router.Handler(http.MethodDelete, "/v1/reviews/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.DeleteReview))))
+
+	router.Handler(http.MethodGet, "/v1/cart", dynamic.ThenFunc(middleware.RequireActivatedUser(handler.ShowCart)))
+	router.Handler(http.MethodDelete, "/v1/cart", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.ClearCart))))
+	router.Handler(http.MethodPut, "/v1/cart/items/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.SetCartItem))))
+	router.Handler(http.MethodDelete, "/v1/cart/items/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.RemoveCartItem))))
+
+	router.Handler(http.MethodGet, "/v1/orders", dynamic.ThenFunc(middleware.RequireActivatedUser(handler.ListOrders)))
+	router.Handler(http.MethodPost, "/v1/orders", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.CreateOrder))))
+	router.Handler(http.MethodGet, "/v1/orders/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(handler.ShowOrder)))
+	router.Handler(http.MethodPost, "/v1/orders/:id/cancel", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.CancelOrder))))
+
+	router.Handler(http.MethodGet, "/v1/invoices", dynamic.ThenFunc(middleware.RequireActivatedUser(handler.ListInvoices)))
+	router.Handler(http.MethodGet, "/v1/invoices/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(handler.ShowInvoice)))
+
+	router.Handler(http.MethodGet, "/v1/tokens/personal", dynamic.ThenFunc(middleware.RequireActivatedUser(handler.ListPersonalAccessTokens)))
+	router.Handler(http.MethodPost, "/v1/tokens/personal", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.CreatePersonalAccessToken))))
+	router.Handler(http.MethodDelete, "/v1/tokens/personal/:id", dynamic.ThenFunc(middleware.RequireActivatedUser(middleware.BlockWhileImpersonating(handler.RevokePersonalAccessToken))))
+
 	router.NotFound = http.HandlerFunc(handler.NotFound)
+	router.MethodNotAllowed = http.HandlerFunc(handler.MethodNotAllowed)
 
-	standard := alice.New(middleware.RecoverPanic, middleware.LogRequest, middleware.SecureHeaders)
-	return standard.Then(router)
+	return router, middleware
 }
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/ruhollahh/paperback/api/docs"
+)
+
+// TestRoutesMatchOpenAPIDocument fails when a /v1 route is added, removed or
+// renamed without the OpenAPI document following suit.
+func TestRoutesMatchOpenAPIDocument(t *testing.T) {
+	a := &API{SessionManager: scs.New()}
+
+	router, _ := a.router()
+
+	apiDocs, err := docs.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing, extra := apiDocs.Drift(router.apiRoutes())
+	for _, route := range missing {
+		t.Errorf("%s is registered but not described in openapi.json", route)
+	}
+	for _, route := range extra {
+		t.Errorf("%s is described in openapi.json but not registered", route)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -27,6 +28,11 @@ func (a *API) Serve() error {
 		},
 	}
 
+	// Every request's context derives from baseCtx, so cancelling it stops
+	// the queries of requests that outlast the shutdown deadline.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", a.Config.Port),
 		Handler:      a.routes(),
@@ -35,6 +41,30 @@ func (a *API) Serve() error {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+
+	var metricsSrv *http.Server
+	if a.Config.Metrics.Addr != "" {
+		metricsSrv = &http.Server{
+			Addr:         a.Config.Metrics.Addr,
+			Handler:      a.Metrics.Handler(),
+			ErrorLog:     slog.NewLogLogger(a.Logger.Handler(), slog.LevelError),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		go func() {
+			a.Logger.Info("starting metrics server", "addr", metricsSrv.Addr)
+
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				a.Logger.Error(err.Error(), "addr", metricsSrv.Addr)
+			}
+		}()
 	}
 
 	shutdownError := make(chan error)
@@ -46,17 +76,32 @@ func (a *API) Serve() error {
 
 		a.Logger.Info("shutting down server", "signal", s.String())
 
+		// Fail readiness first and give load balancers time to notice
+		// before connections are refused.
+		a.draining.Store(true)
+		time.Sleep(a.Config.Health.DrainDelay)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
 		err := srv.Shutdown(ctx)
 		if err != nil {
+			cancelRequests()
 			shutdownError <- err
+			return
 		}
 
 		a.Logger.Info("completing background tasks", "addr", srv.Addr)
 
-		shutdownError <- a.waitForTasks(ctx)
+		err = a.waitForTasks(ctx)
+
+		// The metrics server outlives the background tasks so the drain can
+		// be watched.
+		if metricsSrv != nil {
+			err = errors.Join(err, metricsSrv.Shutdown(ctx))
+		}
+
+		shutdownError <- err
 	}()
 
 	a.Logger.Info("starting server", "addr", srv.Addr, "env", a.Config.Env)
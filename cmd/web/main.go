@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log/slog"
+	"net/http"
+	"net/netip"
 	"os"
 	"strings"
 	"time"
@@ -12,8 +15,14 @@ import (
 	"github.com/go-playground/form/v4"
 	"github.com/ruhollahh/paperback/api"
 	"github.com/ruhollahh/paperback/api/config"
+	"github.com/ruhollahh/paperback/api/contextutil"
+	"github.com/ruhollahh/paperback/api/metrics"
+	"github.com/ruhollahh/paperback/internal/app/domain"
 	"github.com/ruhollahh/paperback/internal/app/service"
 	"github.com/ruhollahh/paperback/internal/mailer"
+	"github.com/ruhollahh/paperback/internal/oidc"
+	"github.com/ruhollahh/paperback/internal/tracing"
+	"github.com/ruhollahh/paperback/pkg/passwordhash"
 )
 
 func main() {
@@ -27,10 +36,28 @@ func main() {
 	flag.IntVar(&cfg.Db.MaxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.Db.MaxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.DurationVar(&cfg.Db.MaxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+	flag.DurationVar(&cfg.Db.QueryTimeout, "db-query-timeout", 3*time.Second, "Longest a single database operation may take")
 
 	flag.Float64Var(&cfg.Limiter.Rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.Limiter.Enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.Limiter.Login.Rps, "limiter-login-rps", 0.2, "Rate limiter maximum requests per second to sign-in endpoints")
+	flag.IntVar(&cfg.Limiter.Login.Burst, "limiter-login-burst", 5, "Rate limiter maximum burst to sign-in endpoints")
+
+	flag.Func("trusted-proxies", "Reverse proxy IPs or CIDR ranges whose X-Forwarded-For header is trusted (space separated)", func(val string) error {
+		for _, field := range strings.Fields(val) {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(field)
+				if addrErr != nil {
+					return err
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			cfg.TrustedProxies = append(cfg.TrustedProxies, prefix.Masked())
+		}
+		return nil
+	})
 
 	flag.StringVar(&cfg.Smtp.Host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.Smtp.Port, "smtp-port", 2525, "SMTP port")
@@ -43,12 +70,105 @@ func main() {
 		return nil
 	})
 
+	flag.StringVar(&cfg.TwoFactor.Issuer, "2fa-issuer", "Paperback", "Issuer shown in authenticator apps")
+
+	cfg.TwoFactor.RequiredPermissions = []string{domain.PermissionProductsWrite}
+	flag.Func("2fa-required-permissions", "Permissions whose holders must enable two-factor authentication (space separated)", func(val string) error {
+		cfg.TwoFactor.RequiredPermissions = strings.Fields(val)
+		return nil
+	})
+
+	flag.IntVar(&cfg.LoginThrottle.MaxAccountFailures, "login-max-account-failures", 5, "Failed logins before an account is temporarily locked")
+	flag.IntVar(&cfg.LoginThrottle.MaxIPFailures, "login-max-ip-failures", 50, "Failed logins before a client IP is temporarily locked")
+	flag.DurationVar(&cfg.LoginThrottle.FailureWindow, "login-failure-window", 15*time.Minute, "How long failed logins are remembered")
+	flag.DurationVar(&cfg.LoginThrottle.LockoutDuration, "login-lockout-duration", 15*time.Minute, "How long a lockout lasts")
+	flag.DurationVar(&cfg.LoginThrottle.BaseDelay, "login-base-delay", time.Second, "Delay required after the first failed login, doubled for each further failure")
+	flag.DurationVar(&cfg.LoginThrottle.MaxDelay, "login-max-delay", 30*time.Second, "Maximum delay required between failed logins")
+
+	flag.DurationVar(&cfg.Permissions.CacheTTL, "permissions-cache-ttl", 0, "How long user permissions are cached in memory (0 disables the cache)")
+
+	flag.IntVar(&cfg.PersonalAccessTokens.MaxTTLDays, "pat-max-ttl-days", 365, "Longest lifetime in days a personal access token may be given")
+
+	flag.IntVar(&cfg.PasswordPolicy.MinLength, "password-min-length", 8, "Minimum password length in characters")
+	flag.StringVar(&cfg.PasswordPolicy.BreachedDir, "password-breached-dir", "", "Directory of breached password SHA-1 hashes split by 5-character prefix (empty disables the check)")
+
+	cfg.PasswordHash.Algorithm = passwordhash.AlgorithmBcrypt
+	flag.Func("password-hash-algorithm", "Algorithm for new password hashes (bcrypt|argon2id); older hashes are upgraded on login", func(val string) error {
+		algorithm, err := passwordhash.ParseAlgorithm(val)
+		cfg.PasswordHash.Algorithm = algorithm
+		return err
+	})
+	cfg.PasswordHash.BcryptCost = 12
+	flag.Func("password-bcrypt-cost", "bcrypt cost, from 4 to 31 (default 12)", func(val string) error {
+		cost, err := passwordhash.ParseBcryptCost(val)
+		cfg.PasswordHash.BcryptCost = cost
+		return err
+	})
+	cfg.PasswordHash.Argon2.Memory = 64 * 1024
+	flag.Func("password-argon2-memory", "argon2id memory in KiB (default 65536)", func(val string) error {
+		memory, err := passwordhash.ParseArgon2Memory(val)
+		cfg.PasswordHash.Argon2.Memory = memory
+		return err
+	})
+	cfg.PasswordHash.Argon2.Time = 3
+	flag.Func("password-argon2-time", "argon2id iterations (default 3)", func(val string) error {
+		iterations, err := passwordhash.ParseArgon2Time(val)
+		cfg.PasswordHash.Argon2.Time = iterations
+		return err
+	})
+	cfg.PasswordHash.Argon2.Threads = 2
+	flag.Func("password-argon2-threads", "argon2id parallelism, from 1 to 255 (default 2)", func(val string) error {
+		threads, err := passwordhash.ParseArgon2Threads(val)
+		cfg.PasswordHash.Argon2.Threads = threads
+		return err
+	})
+
+	cfg.Tracing.Exporter = tracing.ExporterNone
+	flag.Func("tracing-exporter", "Where traces are sent (none|stdout|otlp)", func(val string) error {
+		exporter, err := tracing.ParseExporter(val)
+		cfg.Tracing.Exporter = exporter
+		return err
+	})
+	flag.StringVar(&cfg.Tracing.OTLPEndpoint, "tracing-otlp-endpoint", "", "OTLP/HTTP collector host:port (defaults to OTEL_EXPORTER_OTLP_ENDPOINT, then localhost:4318)")
+	flag.BoolVar(&cfg.Tracing.OTLPInsecure, "tracing-otlp-insecure", false, "Send traces to the OTLP collector over plain HTTP")
+	flag.Float64Var(&cfg.Tracing.SampleRatio, "tracing-sample-ratio", 1, "Share of new traces recorded, between 0 and 1")
+
+	flag.BoolVar(&cfg.Health.CheckSMTP, "health-check-smtp", false, "Report the server as not ready while the SMTP server is unreachable")
+	flag.DurationVar(&cfg.Health.DrainDelay, "shutdown-drain-delay", 0, "How long to keep serving, reported as draining, after a shutdown signal")
+
+	flag.StringVar(&cfg.Metrics.Addr, "metrics-addr", "", "Address of the Prometheus metrics server, kept off the public port (empty disables it)")
+
+	flag.Func("oidc-provider", "OpenID Connect provider as name=,issuer=,client-id=,client-secret=,redirect-url= (repeatable)", func(val string) error {
+		provider, err := oidc.ParseProviderConfig(val)
+		if err != nil {
+			return err
+		}
+		cfg.Oidc.Providers = append(cfg.Oidc.Providers, provider)
+		return nil
+	})
+
 	flag.Parse()
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	logger := slog.New(contextutil.NewLogHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level:     slog.LevelDebug,
 		AddSource: true,
-	}))
+	})))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, "paperback", config.Version, cfg.Env)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := shutdownTracing(ctx)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	}()
 
 	db, err := service.OpenDB(cfg.Db)
 	if err != nil {
@@ -67,13 +187,25 @@ func main() {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
+	services := service.NewServices(db, service.Config{
+		TwoFactor:                     cfg.TwoFactor,
+		LoginThrottle:                 cfg.LoginThrottle,
+		PermissionsCacheTTL:           cfg.Permissions.CacheTTL,
+		PersonalAccessTokenMaxTTLDays: cfg.PersonalAccessTokens.MaxTTLDays,
+		PasswordPolicy:                cfg.PasswordPolicy,
+		PasswordHash:                  cfg.PasswordHash,
+		QueryTimeout:                  cfg.Db.QueryTimeout,
+	})
+
 	a := &api.API{
 		Config:         cfg,
 		Logger:         logger,
-		Services:       service.NewServices(db),
+		Services:       services,
 		Mailer:         mailer.NewMailer(cfg.Smtp.Host, cfg.Smtp.Port, cfg.Smtp.Username, cfg.Smtp.Password, cfg.Smtp.Sender),
 		FormDecoder:    formDecoder,
 		SessionManager: sessionManager,
+		OIDC:           oidc.NewProviders(cfg.Oidc.Providers, &http.Client{Timeout: 10 * time.Second}),
+		Metrics:        metrics.New(db),
 	}
 
 	err = a.Serve()
@@ -0,0 +1,51 @@
+package domain
+
+import "time"
+
+const (
+	AuditTargetUser    = "user"
+	AuditTargetProduct = "product"
+	AuditTargetOrder   = "order"
+)
+
+const (
+	AuditActionPermissionsGranted = "permissions.granted"
+	AuditActionPermissionsRevoked = "permissions.revoked"
+	AuditActionRolesGranted       = "roles.granted"
+	AuditActionRolesRevoked       = "roles.revoked"
+	AuditActionUserUnlocked       = "user.unlocked"
+	AuditActionUserDeleted        = "user.deleted"
+	AuditActionProfileUpdated     = "user.profile_updated"
+	AuditActionPasswordChanged    = "user.password_changed"
+	AuditActionImpersonationStart = "impersonation.started"
+	AuditActionImpersonationStop  = "impersonation.stopped"
+	AuditActionProductCreated     = "product.created"
+	AuditActionProductUpdated     = "product.updated"
+	AuditActionProductDeleted     = "product.deleted"
+	AuditActionOrderCancelled     = "order.cancelled"
+)
+
+// AuditActor is the user making a change and the request it came from. The
+// zero value stands for the system itself.
+type AuditActor struct {
+	UserID    int64
+	IP        string
+	UserAgent string
+}
+
+// AuditEvent records who did what to which entity. ActorID is nil for
+// changes made by the system or by a user that has since been deleted.
+// Before and After hold only the fields the change touched.
+type AuditEvent struct {
+	ID         int64
+	CreatedAt  time.Time
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     map[string]any
+	After      map[string]any
+	Details    map[string]any
+	IP         string
+	UserAgent  string
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// CartItem is a product in a user's cart, priced at the product's current
+// price. The price is only fixed once the cart is checked out as an order.
+type CartItem struct {
+	ProductID int64
+	Title     string
+	Price     int32
+	Quantity  int32
+	AddedAt   time.Time
+}
+
+type Cart struct {
+	UserID int64
+	Items  []CartItem
+	// TotalPrice is the sum of price times quantity over the items.
+	TotalPrice int64
+}
+
+func NewCartQuantity(quantity int32) (int32, error) {
+	if quantity < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	if quantity > 100 {
+		return 0, errors.New("must be a maximum of 100")
+	}
+	return quantity, nil
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Identity links a user to an account at an external OpenID Connect provider.
+type Identity struct {
+	ID        int64
+	CreatedAt time.Time
+	UserID    int64
+	Provider  string
+	Subject   string
+	Email     string
+}
@@ -10,8 +10,10 @@ const (
 )
 
 type Invoice struct {
-	ID        int64
-	OrderID   int64
+	ID      int64
+	OrderID int64
+	// UserID is the owner of the invoiced order.
+	UserID    int64
 	CreatedAt time.Time
 	Status    InvoiceStatus
 	Version   int32
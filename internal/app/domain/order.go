@@ -14,7 +14,7 @@ const (
 type Order struct {
 	ID         int64
 	CreatedAt  time.Time
-	UserID     string
+	UserID     int64
 	TotalPrice int32
 	Status     OrderStatus
 	Version    int32
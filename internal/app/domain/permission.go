@@ -1,3 +1,35 @@
 package domain
 
 type Permissions []string
+
+const (
+	PermissionProductsWrite     = "products:write"
+	PermissionProductsPublish   = "products:publish"
+	PermissionOrdersRead        = "orders:read"
+	PermissionOrdersWrite       = "orders:write"
+	PermissionInvoicesRead      = "invoices:read"
+	PermissionInvoicesWrite     = "invoices:write"
+	PermissionUsersRead         = "users:read"
+	PermissionUsersWrite        = "users:write"
+	PermissionUsersImpersonate  = "users:impersonate"
+	PermissionReviewsWrite      = "reviews:write"
+	PermissionReviewsModerate   = "reviews:moderate"
+	PermissionPermissionsManage = "permissions:manage"
+	PermissionAuditRead         = "audit:read"
+)
+
+const (
+	RoleCustomer   = "customer"
+	RoleEditor     = "editor"
+	RolePublisher  = "publisher"
+	RoleFulfilment = "fulfilment"
+	RoleAccountant = "accountant"
+	RoleAdmin      = "admin"
+)
+
+// Role is a named bundle of permissions that can be assigned to users.
+type Role struct {
+	ID          int64
+	Name        string
+	Permissions Permissions
+}
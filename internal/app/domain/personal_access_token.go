@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const PersonalAccessTokenPrefix = "pb_"
+
+type PersonalAccessToken struct {
+	ID          int64
+	CreatedAt   time.Time
+	UserID      int64
+	Name        string
+	Prefix      string
+	Plaintext   string
+	Hash        []byte
+	Permissions Permissions
+	Expiry      *time.Time
+	LastUsedAt  *time.Time
+}
+
+func NewPersonalAccessTokenName(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("must be provided")
+	}
+	if len(name) > 100 {
+		return "", errors.New("must not be more than 100 bytes long")
+	}
+	return name, nil
+}
+
+func NewPersonalAccessTokenPlaintext(tokenPlaintext string) (string, error) {
+	if tokenPlaintext == "" {
+		return "", errors.New("must be provided")
+	}
+
+	if !strings.HasPrefix(tokenPlaintext, PersonalAccessTokenPrefix) || len(tokenPlaintext) != len(PersonalAccessTokenPrefix)+32 {
+		return "", errors.New("invalid or expired token")
+	}
+
+	return tokenPlaintext, nil
+}
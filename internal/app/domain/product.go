@@ -1,6 +1,9 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type Product struct {
 	ID          int64
@@ -8,5 +11,31 @@ type Product struct {
 	Title       string
 	Description string
 	Price       int32
+	// PublisherID is the user that publishes the product, if any.
+	PublisherID *int64
 	Version     int32
 }
+
+func NewProductTitle(title string) (string, error) {
+	if title == "" {
+		return "", errors.New("must be provided")
+	}
+	if len(title) > 500 {
+		return "", errors.New("must not be more than 500 bytes long")
+	}
+	return title, nil
+}
+
+func NewProductDescription(description string) (string, error) {
+	if len(description) > 10000 {
+		return "", errors.New("must not be more than 10000 bytes long")
+	}
+	return description, nil
+}
+
+func NewProductPrice(price int32) (int32, error) {
+	if price < 1 {
+		return 0, errors.New("must be a positive integer")
+	}
+	return price, nil
+}
@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ruhollahh/paperback/pkg/validation"
+)
+
+const (
+	LanguagePersian = "fa"
+	LanguageEnglish = "en"
+)
+
+var Languages = []string{LanguagePersian, LanguageEnglish}
+
+// Profile is the part of a user's account they can edit themselves.
+type Profile struct {
+	UserID           int64
+	Name             string
+	Email            string
+	Phone            string
+	Language         string
+	NotifyOrders     bool
+	NotifyNewsletter bool
+	Version          int32
+}
+
+var phoneReplacer = strings.NewReplacer(
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4", "۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4", "٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+	" ", "", "-", "",
+)
+
+// NewPhone validates an Iranian mobile number, which is optional, and returns
+// it in its national 09xxxxxxxxx form. Persian digits and the +98 prefix are
+// accepted.
+func NewPhone(phone string) (string, error) {
+	phone = phoneReplacer.Replace(phone)
+	if phone == "" {
+		return "", nil
+	}
+
+	switch {
+	case strings.HasPrefix(phone, "+98"):
+		phone = "0" + phone[3:]
+	case strings.HasPrefix(phone, "0098"):
+		phone = "0" + phone[4:]
+	case strings.HasPrefix(phone, "9"):
+		phone = "0" + phone
+	}
+
+	if !validation.Matches(phone, validation.IranianMobileRX) {
+		return "", errors.New("must be a valid Iranian mobile number")
+	}
+	return phone, nil
+}
+
+func NewLanguage(language string) (string, error) {
+	if !validation.PermittedValue(language, Languages...) {
+		return "", errors.New("must be a supported language")
+	}
+	return language, nil
+}
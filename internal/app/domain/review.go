@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+type Review struct {
+	ID        int64
+	CreatedAt time.Time
+	ProductID int64
+	UserID    int64
+	Rating    int32
+	Body      string
+	Version   int32
+}
+
+func NewReviewRating(rating int32) (int32, error) {
+	if rating < 1 || rating > 5 {
+		return 0, errors.New("must be between 1 and 5")
+	}
+	return rating, nil
+}
+
+func NewReviewBody(body string) (string, error) {
+	if len(body) > 5000 {
+		return "", errors.New("must not be more than 5000 bytes long")
+	}
+	return body, nil
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// Session describes a signed-in device. Token is the scs session token and
+// must never be shown to the user.
+type Session struct {
+	ID         int64
+	Token      string
+	UserID     int64
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	IP         string
+	UserAgent  string
+}
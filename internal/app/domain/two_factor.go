@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ruhollahh/paperback/pkg/validation"
+)
+
+type TOTP struct {
+	UserID       int64
+	CreatedAt    time.Time
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+func (t *TOTP) Confirmed() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+func NewTOTPCode(code string) (string, error) {
+	code = strings.ReplaceAll(code, " ", "")
+	if code == "" {
+		return "", errors.New("must be provided")
+	}
+	if !validation.Matches(code, validation.TOTPCodeRX) {
+		return "", errors.New("must be a 6 digit code")
+	}
+	return code, nil
+}
+
+func NewRecoveryCode(code string) (string, error) {
+	code = strings.ToUpper(strings.ReplaceAll(code, " ", ""))
+	if code == "" {
+		return "", errors.New("must be provided")
+	}
+	if !validation.Matches(code, validation.RecoveryCodeRX) {
+		return "", errors.New("must be a valid recovery code")
+	}
+	return code, nil
+}
@@ -12,8 +12,11 @@ type User struct {
 	Name           string
 	Email          string
 	HashedPassword []byte
-	Activated      bool
-	Version        int32
+	// HasPassword is false for users who only ever signed in with an
+	// external identity, whose password hash is of a password nobody knows.
+	HasPassword bool
+	Activated   bool
+	Version     int32
 }
 
 func NewName(name string) (string, error) {
@@ -36,14 +39,13 @@ func NewEmail(email string) (string, error) {
 	return email, nil
 }
 
+// NewPasswordPlaintext checks the limits every password has; the minimum
+// length and other rules come from the configured password policy.
 func NewPasswordPlaintext(password string) (string, error) {
 	if password == "" {
 		return "", errors.New("must be provided")
 	}
 
-	if len(password) < 8 {
-		return "", errors.New("must be at least 8 bytes long")
-	}
 	if len(password) > 72 {
 		return "", errors.New("must not be more than 72 bytes long")
 	}
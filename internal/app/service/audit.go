@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+func newAuditEvent(actor domain.AuditActor, action, targetType string, targetID int64) *domain.AuditEvent {
+	event := &domain.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   strconv.FormatInt(targetID, 10),
+		IP:         actor.IP,
+		UserAgent:  actor.UserAgent,
+	}
+
+	if actor.UserID != 0 {
+		event.ActorID = &actor.UserID
+	}
+
+	return event
+}
+
+// auditDiff drops the fields before and after agree on, leaving what changed.
+func auditDiff(before, after map[string]any) (map[string]any, map[string]any) {
+	b := make(map[string]any)
+	a := make(map[string]any)
+
+	for key, value := range before {
+		if !reflect.DeepEqual(value, after[key]) {
+			b[key] = value
+		}
+	}
+	for key, value := range after {
+		if !reflect.DeepEqual(value, before[key]) {
+			a[key] = value
+		}
+	}
+
+	return b, a
+}
+
+func marshalAuditField(m map[string]any) ([]byte, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(m)
+}
+
+// insertAuditEvent writes event inside tx so the audit trail can never
+// disagree with the change it describes.
+func insertAuditEvent(ctx context.Context, tx *sql.Tx, event *domain.AuditEvent) error {
+	details, err := marshalAuditField(event.Details)
+	if err != nil {
+		return err
+	}
+
+	before, err := marshalAuditField(event.Before)
+	if err != nil {
+		return err
+	}
+
+	after, err := marshalAuditField(event.After)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO audit_events (actor_id, action, target_type, target_id, details, before, after, ip, user_agent)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING id, created_at`
+
+	args := []any{
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		details,
+		before,
+		after,
+		event.IP,
+		event.UserAgent,
+	}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+}
+
+type AuditService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+// Record writes an audit event for an action that has no database change of
+// its own to share a transaction with.
+func (s AuditService) Record(ctx context.Context, actor domain.AuditActor, action, targetType string, targetID int64) error {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertAuditEvent(ctx, tx, newAuditEvent(actor, action, targetType, targetID))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type GetAllAuditEventsReq struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Filters    Filters
+}
+
+func (s AuditService) GetAll(ctx context.Context, req GetAllAuditEventsReq) ([]domain.AuditEvent, Metadata, error) {
+	var errs errsx.Map
+
+	if req.ActorID < 0 {
+		errs.Set("actor_id", "must be a positive integer")
+	}
+
+	if err := req.Filters.Validate(errs); err != nil {
+		return nil, Metadata{}, fmt.Errorf("%w: %w", ErrBadRequest, err)
+	}
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, actor_id, action, target_type, target_id, details, before, after,
+               ip, user_agent
+        FROM audit_events
+        WHERE (actor_id = $1 OR $1 = 0)
+        AND (action = $2 OR $2 = '')
+        AND (target_type = $3 OR $3 = '')
+        AND (target_id = $4 OR $4 = '')
+        ORDER BY %s %s, id DESC
+        LIMIT $5 OFFSET $6`, req.Filters.sortColumn(), req.Filters.sortDirection())
+
+	args := []any{
+		req.ActorID,
+		req.Action,
+		req.TargetType,
+		req.TargetID,
+		req.Filters.limit(),
+		req.Filters.offset(),
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	events := []domain.AuditEvent{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var (
+			event                  domain.AuditEvent
+			details, before, after []byte
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.CreatedAt,
+			&event.ActorID,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&details,
+			&before,
+			&after,
+			&event.IP,
+			&event.UserAgent,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		for _, field := range []struct {
+			data []byte
+			dst  *map[string]any
+		}{
+			{details, &event.Details},
+			{before, &event.Before},
+			{after, &event.After},
+		} {
+			err = json.Unmarshal(field.data, field.dst)
+			if err != nil {
+				return nil, Metadata{}, err
+			}
+		}
+
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := NewMetadata(totalRecords, req.Filters.Page, req.Filters.PageSize)
+
+	return events, metadata, nil
+}
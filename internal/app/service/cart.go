@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type CartService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func (s CartService) Get(ctx context.Context, userID int64) (*domain.Cart, error) {
+	query := `
+        SELECT cart_items.product_id, products.title, products.price, cart_items.quantity, cart_items.added_at
+        FROM cart_items
+        INNER JOIN products
+        ON products.id = cart_items.product_id
+        WHERE cart_items.user_id = $1
+        ORDER BY cart_items.added_at, cart_items.product_id`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cart := domain.Cart{
+		UserID: userID,
+		Items:  []domain.CartItem{},
+	}
+
+	for rows.Next() {
+		var item domain.CartItem
+
+		err := rows.Scan(
+			&item.ProductID,
+			&item.Title,
+			&item.Price,
+			&item.Quantity,
+			&item.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		cart.Items = append(cart.Items, item)
+		cart.TotalPrice += int64(item.Price) * int64(item.Quantity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
+
+type SetCartItemReq struct {
+	UserID    int64
+	ProductID int64
+	Quantity  int32
+}
+
+func validateCartQuantity(quantity int32) error {
+	var errs errsx.Map
+
+	if _, err := domain.NewCartQuantity(quantity); err != nil {
+		errs.Set("quantity", err)
+	}
+
+	if errs != nil {
+		return fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	return nil
+}
+
+// SetItem puts quantity of a product in the user's cart, replacing whatever
+// quantity was there. A quantity of zero removes the product.
+func (s CartService) SetItem(ctx context.Context, req SetCartItemReq) error {
+	if req.ProductID < 1 {
+		return ErrRecordNotFound
+	}
+
+	err := validateCartQuantity(req.Quantity)
+	if err != nil {
+		return err
+	}
+
+	if req.Quantity == 0 {
+		err = s.RemoveItem(ctx, req.UserID, req.ProductID)
+		if errors.Is(err, ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	query := `
+        INSERT INTO cart_items (user_id, product_id, quantity)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, product_id) DO UPDATE
+        SET quantity = EXCLUDED.quantity`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	_, err = s.DB.ExecContext(ctx, query, req.UserID, req.ProductID, req.Quantity)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s CartService) RemoveItem(ctx context.Context, userID, productID int64) error {
+	query := `
+        DELETE FROM cart_items
+        WHERE user_id = $1 AND product_id = $2`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, userID, productID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s CartService) Clear(ctx context.Context, userID int64) error {
+	query := `
+        DELETE FROM cart_items
+        WHERE user_id = $1`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query, userID)
+	return err
+}
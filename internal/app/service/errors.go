@@ -3,8 +3,18 @@ package service
 import "errors"
 
 var (
-	ErrDuplicateEmail = errors.New("duplicate email")
-	ErrBadRequest     = errors.New("bad request")
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
+	ErrDuplicateEmail  = errors.New("duplicate email")
+	ErrBadRequest      = errors.New("bad request")
+	ErrRecordNotFound  = errors.New("record not found")
+	ErrEditConflict    = errors.New("edit conflict")
+	ErrDuplicateReview = errors.New("duplicate review")
+	ErrProductOrdered  = errors.New("product has been ordered")
+
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrRecentLoginRequired  = errors.New("recent sign-in required")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication already enabled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrUnverifiedEmail      = errors.New("unverified email")
+	ErrAccountLocked        = errors.New("account temporarily locked")
+	ErrLoginThrottled       = errors.New("too many login attempts")
 )
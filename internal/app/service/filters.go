@@ -15,13 +15,13 @@ type Filters struct {
 }
 
 func (f Filters) Validate(errors errsx.Map) error {
-	if f.Page < 0 {
+	if f.Page < 1 {
 		errors.Set("page", "must be greater than zero")
 	}
 	if f.Page > 10_000_000 {
 		errors.Set("page", "must be a maximum of 10 million")
 	}
-	if f.PageSize < 0 {
+	if f.PageSize < 1 {
 		errors.Set("page_size", "must be greater than zero")
 	}
 	if f.PageSize > 100 {
@@ -31,6 +31,11 @@ func (f Filters) Validate(errors errsx.Map) error {
 		errors.Set("sort", "invalid sort value")
 	}
 
+	// A nil Map would still make a non-nil error.
+	if len(errors) == 0 {
+		return nil
+	}
+
 	return errors
 }
 
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type HealthService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func (s HealthService) Ping(ctx context.Context) error {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	return s.DB.PingContext(ctx)
+}
+
+// MigrationVersion returns the schema version golang-migrate recorded, and
+// whether the last migration failed halfway.
+func (s HealthService) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	query := `
+        SELECT version, dirty
+        FROM schema_migrations
+        LIMIT 1`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	var (
+		version uint
+		dirty   bool
+	)
+
+	err := s.DB.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/passwordhash"
+)
+
+type IdentityService struct {
+	DB               *sql.DB
+	Hasher           *passwordhash.Hasher
+	PermissionsCache *PermissionsCache
+	QueryTimeout     time.Duration
+}
+
+type LoginWithIdentityReq struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// LoginWithIdentity returns the user linked to an external identity. Unknown
+// identities are linked to the existing user with the same email, or to a new
+// user, but only when the provider has verified the email address.
+func (s IdentityService) LoginWithIdentity(ctx context.Context, req LoginWithIdentityReq) (*domain.User, error) {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.has_password, users.activated, users.version
+        FROM users
+        INNER JOIN user_identities
+        ON users.id = user_identities.user_id
+        WHERE user_identities.provider = $1 AND user_identities.subject = $2`
+
+	user, err := scanUser(tx.QueryRowContext(ctx, query, req.Provider, req.Subject))
+	if err == nil {
+		return user, tx.Commit()
+	}
+	if !errors.Is(err, ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if !req.EmailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+
+	email, err := domain.NewEmail(req.Email)
+	if err != nil {
+		return nil, ErrUnverifiedEmail
+	}
+
+	query = `
+        SELECT id, created_at, name, email, password_hash, has_password, activated, version
+        FROM users
+        WHERE email = $1
+        FOR UPDATE`
+
+	user, err = scanUser(tx.QueryRowContext(ctx, query, email))
+	switch {
+	case errors.Is(err, ErrRecordNotFound):
+		user, err = createIdentityUser(ctx, tx, s.Hasher, req.Name, email)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !user.Activated:
+		// Whoever signed up with this address never proved they own it, and
+		// may not be the person the provider has just vouched for. Hand the
+		// account to the address's owner: the unproven password and anything
+		// issued under it must not outlive the takeover.
+		err = claimUnactivatedUser(ctx, tx, s.Hasher, user)
+		if err != nil {
+			return nil, err
+		}
+
+		defer s.PermissionsCache.invalidate(user.ID)
+	}
+
+	query = `
+        INSERT INTO user_identities (user_id, provider, subject, email)
+        VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, query, user.ID, req.Provider, req.Subject, email)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s IdentityService) GetAllForUser(ctx context.Context, userID int64) ([]domain.Identity, error) {
+	query := `
+        SELECT id, created_at, user_id, provider, subject, email
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []domain.Identity{}
+
+	for rows.Next() {
+		var identity domain.Identity
+
+		err := rows.Scan(
+			&identity.ID,
+			&identity.CreatedAt,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func createIdentityUser(ctx context.Context, tx *sql.Tx, hasher *passwordhash.Hasher, name, email string) (*domain.User, error) {
+	name, err := domain.NewName(name)
+	if err != nil {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	// Users created from an identity have no password of their own.
+	hash, err := unusablePasswordHash(hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO users (name, email, password_hash, has_password, activated)
+        VALUES ($1, $2, $3, false, true)
+        RETURNING id, created_at, version`
+
+	user := domain.User{
+		Name:           name,
+		Email:          email,
+		HashedPassword: hash,
+		Activated:      true,
+	}
+
+	err = tx.QueryRowContext(ctx, query, user.Name, user.Email, user.HashedPassword).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = addDefaultRole(ctx, tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// claimUnactivatedUser activates user on behalf of a verified identity,
+// replacing the password and revoking every session and token issued before
+// the address was proven.
+func claimUnactivatedUser(ctx context.Context, tx *sql.Tx, hasher *passwordhash.Hasher, user *domain.User) error {
+	hash, err := unusablePasswordHash(hasher)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`DELETE FROM sessions WHERE token IN (SELECT token FROM user_sessions WHERE user_id = $1)`,
+		`DELETE FROM user_sessions WHERE user_id = $1`,
+		`DELETE FROM tokens WHERE user_id = $1`,
+		`DELETE FROM personal_access_tokens WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM users_totp WHERE user_id = $1`,
+	}
+
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+        UPDATE users
+        SET password_hash = $2, has_password = false, activated = true, version = version + 1
+        WHERE id = $1
+        RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, user.ID, hash).Scan(&user.Version)
+	if err != nil {
+		return err
+	}
+
+	user.HashedPassword = hash
+	user.HasPassword = false
+	user.Activated = true
+
+	return nil
+}
+
+func scanUser(row *sql.Row) (*domain.User, error) {
+	var user domain.User
+
+	err := row.Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.HashedPassword,
+		&user.HasPassword,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoginWithIdentity(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("new email creates an activated user", func(t *testing.T) {
+		db := newTestDB(t)
+		s := IdentityService{DB: db, Hasher: testHasher}
+
+		user, err := s.LoginWithIdentity(ctx, LoginWithIdentityReq{
+			Provider:      "test",
+			Subject:       "subject-1",
+			Email:         "new@example.com",
+			EmailVerified: true,
+			Name:          "New User",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !user.Activated {
+			t.Error("user is not activated")
+		}
+		if user.HasPassword {
+			t.Error("user created from an identity has a password")
+		}
+		if user.Email != "new@example.com" {
+			t.Errorf("email = %q, want new@example.com", user.Email)
+		}
+		if n := countRows(t, db, `SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, user.ID); n != 1 {
+			t.Errorf("identities = %d, want 1", n)
+		}
+		if n := countRows(t, db, `SELECT COUNT(*) FROM users_roles WHERE user_id = $1`, user.ID); n != 1 {
+			t.Errorf("roles = %d, want the default role", n)
+		}
+	})
+
+	t.Run("known identity signs in its user", func(t *testing.T) {
+		db := newTestDB(t)
+		s := IdentityService{DB: db, Hasher: testHasher}
+
+		req := LoginWithIdentityReq{Provider: "test", Subject: "subject-1", Email: "known@example.com", EmailVerified: true}
+
+		first, err := s.LoginWithIdentity(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The provider's record of the email may change, or stop being
+		// verified; the identity alone decides who signs in.
+		req.Email = "changed@example.com"
+		req.EmailVerified = false
+
+		second, err := s.LoginWithIdentity(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if second.ID != first.ID {
+			t.Errorf("signed in user %d, want %d", second.ID, first.ID)
+		}
+	})
+
+	t.Run("unverified email is refused", func(t *testing.T) {
+		db := newTestDB(t)
+		s := IdentityService{DB: db, Hasher: testHasher}
+
+		userID := insertTestUser(t, db, "victim@example.com", "victim-password", true)
+
+		_, err := s.LoginWithIdentity(ctx, LoginWithIdentityReq{
+			Provider: "test",
+			Subject:  "subject-1",
+			Email:    "victim@example.com",
+		})
+		if !errors.Is(err, ErrUnverifiedEmail) {
+			t.Fatalf("err = %v, want ErrUnverifiedEmail", err)
+		}
+
+		if n := countRows(t, db, `SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userID); n != 0 {
+			t.Errorf("identities = %d, want none", n)
+		}
+		if n := countRows(t, db, `SELECT COUNT(*) FROM users`); n != 1 {
+			t.Errorf("users = %d, want no new user", n)
+		}
+	})
+
+	t.Run("activated user with the email is linked", func(t *testing.T) {
+		db := newTestDB(t)
+		s := IdentityService{DB: db, Hasher: testHasher}
+
+		userID := insertTestUser(t, db, "owner@example.com", "owner-password", true)
+
+		user, err := s.LoginWithIdentity(ctx, LoginWithIdentityReq{
+			Provider:      "test",
+			Subject:       "subject-1",
+			Email:         "OWNER@example.com",
+			EmailVerified: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if user.ID != userID {
+			t.Fatalf("signed in user %d, want %d", user.ID, userID)
+		}
+
+		// The owner's own password keeps working.
+		p := password{hash: user.HashedPassword}
+		match, err := p.Matches(testHasher, "owner-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !match {
+			t.Error("linking replaced an activated user's password")
+		}
+	})
+
+	t.Run("unactivated user with the email is claimed", func(t *testing.T) {
+		db := newTestDB(t)
+		s := IdentityService{DB: db, Hasher: testHasher}
+
+		// Someone signed up with the victim's address and a password they
+		// know, and never activated the account.
+		userID := insertTestUser(t, db, "victim@example.com", "attacker-password", false)
+
+		setup := []string{
+			`INSERT INTO sessions (token, data, expiry) VALUES ('attacker-session', '\x00', NOW() + INTERVAL '1 day')`,
+			`INSERT INTO user_sessions (token, user_id, ip, user_agent) VALUES ('attacker-session', $1, '192.0.2.1', 'test')`,
+			`INSERT INTO tokens (hash, user_id, expiry, scope) VALUES ('\x01', $1, NOW() + INTERVAL '1 day', 'activation')`,
+			`INSERT INTO personal_access_tokens (user_id, name, prefix, hash, permissions) VALUES ($1, 'attacker', 'pb_AAAAA', '\x02', '{}')`,
+			`INSERT INTO users_totp (user_id, secret) VALUES ($1, 'JBSWY3DPEHPK3PXP')`,
+		}
+		for _, statement := range setup {
+			var args []any
+			if strings.Contains(statement, "$1") {
+				args = append(args, userID)
+			}
+
+			_, err := db.ExecContext(ctx, statement, args...)
+			if err != nil {
+				t.Fatalf("%s: %v", statement, err)
+			}
+		}
+
+		user, err := s.LoginWithIdentity(ctx, LoginWithIdentityReq{
+			Provider:      "test",
+			Subject:       "victim-subject",
+			Email:         "victim@example.com",
+			EmailVerified: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if user.ID != userID {
+			t.Fatalf("signed in user %d, want %d", user.ID, userID)
+		}
+		if !user.Activated {
+			t.Error("user is not activated")
+		}
+
+		stored, err := UserService{DB: db}.GetByID(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.HasPassword {
+			t.Error("claimed user still has a password")
+		}
+
+		p := password{hash: stored.HashedPassword}
+		match, err := p.Matches(testHasher, "attacker-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match {
+			t.Error("the password set before the address was proven still works")
+		}
+
+		leftovers := map[string]string{
+			"sessions":               `SELECT COUNT(*) FROM sessions WHERE token = 'attacker-session'`,
+			"user_sessions":          `SELECT COUNT(*) FROM user_sessions WHERE user_id = $1`,
+			"tokens":                 `SELECT COUNT(*) FROM tokens WHERE user_id = $1`,
+			"personal_access_tokens": `SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = $1`,
+			"users_totp":             `SELECT COUNT(*) FROM users_totp WHERE user_id = $1`,
+		}
+		for table, query := range leftovers {
+			var args []any
+			if strings.Contains(query, "$1") {
+				args = append(args, userID)
+			}
+
+			if n := countRows(t, db, query, args...); n != 0 {
+				t.Errorf("%s: %d rows left, want none", table, n)
+			}
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+type InvoiceService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func (s InvoiceService) Get(ctx context.Context, id int64) (*domain.Invoice, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT invoices.id, invoices.order_id, orders.user_id, invoices.created_at, invoices.status, invoices.version
+        FROM invoices
+        INNER JOIN orders ON orders.id = invoices.order_id
+        WHERE invoices.id = $1`
+
+	var invoice domain.Invoice
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(
+		&invoice.ID,
+		&invoice.OrderID,
+		&invoice.UserID,
+		&invoice.CreatedAt,
+		&invoice.Status,
+		&invoice.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invoice, nil
+}
+
+func (s InvoiceService) GetAllForUser(ctx context.Context, userID int64) ([]domain.Invoice, error) {
+	query := `
+        SELECT invoices.id, invoices.order_id, orders.user_id, invoices.created_at, invoices.status, invoices.version
+        FROM invoices
+        INNER JOIN orders ON orders.id = invoices.order_id
+        WHERE orders.user_id = $1
+        ORDER BY invoices.created_at DESC, invoices.id DESC`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []domain.Invoice{}
+
+	for rows.Next() {
+		var invoice domain.Invoice
+
+		err := rows.Scan(
+			&invoice.ID,
+			&invoice.OrderID,
+			&invoice.UserID,
+			&invoice.CreatedAt,
+			&invoice.Status,
+			&invoice.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		invoices = append(invoices, invoice)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+const (
+	loginFailureKindAccount = "account"
+	loginFailureKindIP      = "ip"
+)
+
+type LoginThrottleConfig struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	// FailureWindow is how long a failure is remembered; a failure after a
+	// quiet period this long starts the count again.
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+}
+
+// LoginThrottleService tracks failed logins per account (keyed by email, so
+// unknown addresses behave like known ones) and per client IP.
+type LoginThrottleService struct {
+	DB           *sql.DB
+	Config       LoginThrottleConfig
+	QueryTimeout time.Duration
+}
+
+func (s LoginThrottleService) delay(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	d := s.Config.BaseDelay
+	for i := 1; i < failures && d < s.Config.MaxDelay; i++ {
+		d *= 2
+	}
+
+	return min(d, s.Config.MaxDelay)
+}
+
+// Check reports whether a login attempt for email from ip may proceed. When it
+// may not, the returned duration is how long the client should wait.
+func (s LoginThrottleService) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	query := `
+        SELECT kind, failures, last_failed_at, locked_until
+        FROM login_failures
+        WHERE (kind = $1 AND key = $2) OR (kind = $3 AND key = $4)`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, loginFailureKindAccount, email, loginFailureKindIP, ip)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+
+	var retryAfter time.Duration
+	var retryErr error
+
+	for rows.Next() {
+		var (
+			kind         string
+			failures     int
+			lastFailedAt time.Time
+			lockedUntil  *time.Time
+		)
+
+		err := rows.Scan(&kind, &failures, &lastFailedAt, &lockedUntil)
+		if err != nil {
+			return 0, err
+		}
+
+		if lockedUntil != nil && lockedUntil.After(now) {
+			if kind == loginFailureKindAccount {
+				return lockedUntil.Sub(now), ErrAccountLocked
+			}
+
+			retryAfter, retryErr = max(retryAfter, lockedUntil.Sub(now)), ErrLoginThrottled
+			continue
+		}
+
+		if lastFailedAt.Before(now.Add(-s.Config.FailureWindow)) {
+			continue
+		}
+
+		next := lastFailedAt.Add(s.delay(failures))
+		if next.After(now) {
+			retryAfter, retryErr = max(retryAfter, next.Sub(now)), ErrLoginThrottled
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return retryAfter, retryErr
+}
+
+// RecordFailure counts a failed attempt and reports whether it caused the
+// account to become locked.
+func (s LoginThrottleService) RecordFailure(ctx context.Context, email, ip string) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	accountLocked, err := s.recordFailure(ctx, tx, loginFailureKindAccount, email, s.Config.MaxAccountFailures)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.recordFailure(ctx, tx, loginFailureKindIP, ip, s.Config.MaxIPFailures)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return accountLocked, nil
+}
+
+func (s LoginThrottleService) recordFailure(ctx context.Context, tx *sql.Tx, kind, key string, maxFailures int) (bool, error) {
+	now := time.Now()
+
+	query := `
+        INSERT INTO login_failures (kind, key, failures, last_failed_at)
+        VALUES ($1, $2, 1, $3)
+        ON CONFLICT (kind, key) DO UPDATE
+        SET failures = CASE WHEN login_failures.last_failed_at < $4 THEN 1 ELSE login_failures.failures + 1 END,
+            last_failed_at = EXCLUDED.last_failed_at
+        RETURNING failures, locked_until`
+
+	var failures int
+	var lockedUntil *time.Time
+
+	err := tx.QueryRowContext(ctx, query, kind, key, now, now.Add(-s.Config.FailureWindow)).Scan(&failures, &lockedUntil)
+	if err != nil {
+		return false, err
+	}
+
+	if failures < maxFailures || (lockedUntil != nil && lockedUntil.After(now)) {
+		return false, nil
+	}
+
+	query = `
+        UPDATE login_failures
+        SET locked_until = $3
+        WHERE kind = $1 AND key = $2`
+
+	_, err = tx.ExecContext(ctx, query, kind, key, now.Add(s.Config.LockoutDuration))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RecordSuccess clears the account's failure history. The IP's history is
+// kept so one valid account can't be used to reset a guessing run.
+func (s LoginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	query := `
+        DELETE FROM login_failures
+        WHERE kind = $1 AND key = $2`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query, loginFailureKindAccount, email)
+	return err
+}
+
+// Unlock clears the account's failure history, lifting any lockout. Unlocking
+// a user who isn't locked out is not an error; only an unknown user is.
+func (s LoginThrottleService) Unlock(ctx context.Context, actor domain.AuditActor, userID int64) error {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+
+	err = tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query := `
+        DELETE FROM login_failures
+        WHERE kind = $1 AND key = $2`
+
+	_, err = tx.ExecContext(ctx, query, loginFailureKindAccount, email)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEvent(ctx, tx, newAuditEvent(actor, domain.AuditActionUserUnlocked, domain.AuditTargetUser, userID))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
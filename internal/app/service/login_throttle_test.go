@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+func TestLoginThrottleUnlock(t *testing.T) {
+	ctx := context.Background()
+	actor := domain.AuditActor{IP: "192.0.2.1"}
+
+	db := newTestDB(t)
+	s := LoginThrottleService{DB: db, Config: LoginThrottleConfig{
+		MaxAccountFailures: 2,
+		MaxIPFailures:      100,
+		FailureWindow:      time.Hour,
+		LockoutDuration:    time.Hour,
+		BaseDelay:          time.Millisecond,
+		MaxDelay:           time.Millisecond,
+	}}
+
+	lockedID := insertTestUser(t, db, "locked@example.com", "password", true)
+	for i := 0; i < 2; i++ {
+		_, err := s.RecordFailure(ctx, "locked@example.com", "192.0.2.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.Unlock(ctx, actor, lockedID)
+	if err != nil {
+		t.Fatalf("unlocking a locked user: %v", err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM login_failures WHERE kind = $1 AND key = $2`, loginFailureKindAccount, "locked@example.com"); n != 0 {
+		t.Errorf("account failures = %d after unlocking, want none", n)
+	}
+
+	// Unlocking is idempotent: a user with nothing to clear still exists.
+	err = s.Unlock(ctx, actor, lockedID)
+	if err != nil {
+		t.Errorf("unlocking a user who isn't locked out: %v", err)
+	}
+
+	err = s.Unlock(ctx, actor, lockedID+1000)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("unlocking an unknown user: err = %v, want ErrRecordNotFound", err)
+	}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type OrderService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func (s OrderService) Get(ctx context.Context, id int64) (*domain.Order, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, user_id, total_price, status, version
+        FROM orders
+        WHERE id = $1`
+
+	var order domain.Order
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(
+		&order.ID,
+		&order.CreatedAt,
+		&order.UserID,
+		&order.TotalPrice,
+		&order.Status,
+		&order.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &order, nil
+}
+
+func (s OrderService) GetItems(ctx context.Context, orderID int64) ([]domain.OrderItem, error) {
+	query := `
+        SELECT order_id, product_id, quantity, price, version
+        FROM order_items
+        WHERE order_id = $1
+        ORDER BY product_id`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []domain.OrderItem{}
+
+	for rows.Next() {
+		var item domain.OrderItem
+
+		err := rows.Scan(
+			&item.OrderID,
+			&item.ProductID,
+			&item.Quantity,
+			&item.Price,
+			&item.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (s OrderService) GetAllForUser(ctx context.Context, userID int64) ([]domain.Order, error) {
+	query := `
+        SELECT id, created_at, user_id, total_price, status, version
+        FROM orders
+        WHERE user_id = $1
+        ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []domain.Order{}
+
+	for rows.Next() {
+		var order domain.Order
+
+		err := rows.Scan(
+			&order.ID,
+			&order.CreatedAt,
+			&order.UserID,
+			&order.TotalPrice,
+			&order.Status,
+			&order.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// Checkout turns the user's cart into a new order, priced at the products'
+// current prices, with an unpaid invoice for it. The cart is emptied.
+func (s OrderService) Checkout(ctx context.Context, userID int64) (*domain.Order, []domain.OrderItem, error) {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT cart_items.product_id, cart_items.quantity, products.price
+        FROM cart_items
+        INNER JOIN products
+        ON products.id = cart_items.product_id
+        WHERE cart_items.user_id = $1
+        ORDER BY cart_items.product_id
+        FOR UPDATE OF cart_items`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	items := []domain.OrderItem{}
+	var total int64
+
+	for rows.Next() {
+		var item domain.OrderItem
+
+		err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		items = append(items, item)
+		total += int64(item.Price) * int64(item.Quantity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var errs errsx.Map
+	switch {
+	case len(items) == 0:
+		errs.Set("cart", "must contain at least 1 item")
+	case total > math.MaxInt32:
+		errs.Set("cart", "total price is too large for a single order")
+	}
+	if errs != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	order := domain.Order{
+		UserID:     userID,
+		TotalPrice: int32(total),
+		Status:     domain.OrderStatusNew,
+	}
+
+	query = `
+        INSERT INTO orders (user_id, status, total_price)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at, version`
+
+	err = tx.QueryRowContext(ctx, query, order.UserID, order.Status, order.TotalPrice).Scan(&order.ID, &order.CreatedAt, &order.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query = `
+        INSERT INTO order_items (order_id, product_id, quantity, price)
+        VALUES ($1, $2, $3, $4)
+        RETURNING version`
+
+	for i := range items {
+		items[i].OrderID = order.ID
+
+		err = tx.QueryRowContext(ctx, query, order.ID, items[i].ProductID, items[i].Quantity, items[i].Price).Scan(&items[i].Version)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	query = `
+        INSERT INTO invoices (order_id, status)
+        VALUES ($1, $2)`
+
+	_, err = tx.ExecContext(ctx, query, order.ID, domain.InvoiceStatusUnpaid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM cart_items WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &order, items, nil
+}
+
+type CancelOrderReq struct {
+	Actor   domain.AuditActor
+	ID      int64
+	Version int32
+}
+
+// Cancel cancels an order that hasn't been delivered yet. Who may cancel which
+// order is for the caller to decide.
+func (s OrderService) Cancel(ctx context.Context, req CancelOrderReq) (*domain.Order, error) {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT id, created_at, user_id, total_price, status, version
+        FROM orders
+        WHERE id = $1
+        FOR UPDATE`
+
+	var order domain.Order
+
+	err = tx.QueryRowContext(ctx, query, req.ID).Scan(
+		&order.ID,
+		&order.CreatedAt,
+		&order.UserID,
+		&order.TotalPrice,
+		&order.Status,
+		&order.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if order.Version != req.Version {
+		return nil, ErrEditConflict
+	}
+
+	if order.Status != domain.OrderStatusNew && order.Status != domain.OrderStatusInProgress {
+		var errs errsx.Map
+		errs.Set("status", fmt.Sprintf("a %s order can't be cancelled", order.Status))
+		return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	query = `
+        UPDATE orders
+        SET status = $1, version = version + 1
+        WHERE id = $2
+        RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, domain.OrderStatusCancelled, order.ID).Scan(&order.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	event := newAuditEvent(req.Actor, domain.AuditActionOrderCancelled, domain.AuditTargetOrder, order.ID)
+	event.Before = map[string]any{"status": order.Status}
+	event.After = map[string]any{"status": domain.OrderStatusCancelled}
+	order.Status = domain.OrderStatusCancelled
+
+	err = insertAuditEvent(ctx, tx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
@@ -3,9 +3,14 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/lib/pq"
 	"github.com/ruhollahh/paperback/internal/app/domain"
-	"time"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/pkg/validation"
 )
 
 func PermissionsInclude(p domain.Permissions, code string) bool {
@@ -18,18 +23,33 @@ func PermissionsInclude(p domain.Permissions, code string) bool {
 }
 
 type PermissionsService struct {
-	DB *sql.DB
+	DB           *sql.DB
+	Cache        *PermissionsCache
+	QueryTimeout time.Duration
 }
 
-func (s PermissionsService) GetAllForUser(userID int64) (domain.Permissions, error) {
+func (s PermissionsService) GetAllForUser(ctx context.Context, userID int64) (domain.Permissions, error) {
+	if permissions, ok := s.Cache.get(userID); ok {
+		return permissions, nil
+	}
+
+	generation := s.Cache.currentGeneration()
+
+	// Effective permissions are the direct grants merged with everything the
+	// user's roles bundle.
 	query := `
         SELECT permissions.code
         FROM permissions
         INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-        INNER JOIN users ON users_permissions.user_id = users.id
-        WHERE users.id = $1`
+        WHERE users_permissions.user_id = $1
+        UNION
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+        INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+        WHERE users_roles.user_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
 	rows, err := s.DB.QueryContext(ctx, query, userID)
@@ -54,17 +74,253 @@ func (s PermissionsService) GetAllForUser(userID int64) (domain.Permissions, err
 		return nil, err
 	}
 
+	s.Cache.set(userID, permissions, generation)
+
 	return permissions, nil
 }
 
-func (s PermissionsService) AddForUser(userID int64, codes ...string) error {
+func (s PermissionsService) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
         INSERT INTO users_permissions
         SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
+	defer s.Cache.invalidate(userID)
+
 	_, err := s.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+func (s PermissionsService) GetAll(ctx context.Context) (domain.Permissions, error) {
+	query := `
+        SELECT code
+        FROM permissions
+        ORDER BY code`
+
+	return s.queryCodes(ctx, query)
+}
+
+// GetDirectForUser returns only the permissions granted to the user
+// individually, leaving out those that come from roles.
+func (s PermissionsService) GetDirectForUser(ctx context.Context, userID int64) (domain.Permissions, error) {
+	query := `
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+        WHERE users_permissions.user_id = $1
+        ORDER BY permissions.code`
+
+	return s.queryCodes(ctx, query, userID)
+}
+
+func (s PermissionsService) queryCodes(ctx context.Context, query string, args ...any) (domain.Permissions, error) {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := domain.Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// GetUsersWithPermission returns every user holding code, directly or through
+// a role.
+func (s PermissionsService) GetUsersWithPermission(ctx context.Context, code string) ([]domain.User, error) {
+	catalogue, err := s.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !PermissionsInclude(catalogue, code) {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, name, email, activated, version
+        FROM users
+        WHERE id IN (
+            SELECT users_permissions.user_id
+            FROM users_permissions
+            INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+            WHERE permissions.code = $1
+            UNION
+            SELECT users_roles.user_id
+            FROM users_roles
+            INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+            INNER JOIN permissions ON permissions.id = roles_permissions.permission_id
+            WHERE permissions.code = $1
+        )
+        ORDER BY id`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+
+	for rows.Next() {
+		var user domain.User
+
+		err := rows.Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+type ChangePermissionsReq struct {
+	Actor  domain.AuditActor
+	UserID int64
+	Codes  []string
+}
+
+func (s PermissionsService) GrantForUser(ctx context.Context, req ChangePermissionsReq) error {
+	catalogue, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = validateNames("permissions", req.Codes, catalogue)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO users_permissions
+        SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+        ON CONFLICT DO NOTHING`
+
+	defer s.Cache.invalidate(req.UserID)
+
+	return changeGrants(ctx, s.DB, s.QueryTimeout, query, req.Actor, req.UserID, req.Codes, domain.AuditActionPermissionsGranted)
+}
+
+func (s PermissionsService) RevokeForUser(ctx context.Context, req ChangePermissionsReq) error {
+	catalogue, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = validateNames("permissions", req.Codes, catalogue)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        DELETE FROM users_permissions
+        USING permissions
+        WHERE users_permissions.permission_id = permissions.id
+        AND users_permissions.user_id = $1 AND permissions.code = ANY($2)`
+
+	defer s.Cache.invalidate(req.UserID)
+
+	return changeGrants(ctx, s.DB, s.QueryTimeout, query, req.Actor, req.UserID, req.Codes, domain.AuditActionPermissionsRevoked)
+}
+
+func validateNames(key string, names, catalogue []string) error {
+	var errs errsx.Map
+
+	switch {
+	case len(names) == 0:
+		errs.Set(key, "must contain at least 1 entry")
+	case !validation.Unique(names):
+		errs.Set(key, "must not contain duplicate values")
+	default:
+		for _, name := range names {
+			if !validation.PermittedValue(name, catalogue...) {
+				errs.Set(key, fmt.Sprintf("%q does not exist", name))
+				break
+			}
+		}
+	}
+
+	if errs != nil {
+		return fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	return nil
+}
+
+// changeGrants runs a grant or revoke statement taking the user ID and a list
+// of names, and records it in the audit trail in the same transaction.
+func changeGrants(ctx context.Context, db *sql.DB, timeout time.Duration, query string, actor domain.AuditActor, userID int64, names []string, action string) error {
+	ctx, cancel := withQueryTimeout(ctx, timeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userID, pq.Array(names))
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Nothing changed: the user already had (or never had) every entry.
+	if rowsAffected == 0 {
+		return tx.Commit()
+	}
+
+	event := newAuditEvent(actor, action, domain.AuditTargetUser, userID)
+	event.Details = map[string]any{"names": names}
+
+	err = insertAuditEvent(ctx, tx, event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+// PermissionsCache keeps users' effective permissions in memory for a short
+// while. It is local to the process, so with several instances a change made
+// through one of them may take up to the TTL to be seen by the others.
+type PermissionsCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[int64]permissionsCacheEntry
+	nextSweep time.Time
+	// generation counts invalidations. A lookup that began before one may
+	// have read the grants it replaced, so its result is not stored.
+	generation uint64
+}
+
+type permissionsCacheEntry struct {
+	permissions domain.Permissions
+	expiry      time.Time
+}
+
+// NewPermissionsCache returns a cache holding entries for ttl, or nil, which
+// disables caching, when ttl is not positive.
+func NewPermissionsCache(ttl time.Duration) *PermissionsCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &PermissionsCache{
+		ttl:     ttl,
+		entries: make(map[int64]permissionsCacheEntry),
+	}
+}
+
+func (c *PermissionsCache) get(userID int64) (domain.Permissions, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[userID]
+	if !ok || time.Now().After(entry.expiry) {
+		return nil, false
+	}
+
+	return entry.permissions, true
+}
+
+// currentGeneration is taken before reading a user's permissions from the
+// database and handed back to set with what was read.
+func (c *PermissionsCache) currentGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// set stores permissions read since generation, unless an invalidation has
+// happened in the meantime: the read may have raced the change and seen the
+// grants from before it.
+func (c *PermissionsCache) set(userID int64, permissions domain.Permissions, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+
+	// Drop expired entries now and then so users who have gone away don't
+	// stay in memory.
+	if now.After(c.nextSweep) {
+		for id, entry := range c.entries {
+			if now.After(entry.expiry) {
+				delete(c.entries, id)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+
+	c.entries[userID] = permissionsCacheEntry{
+		permissions: permissions,
+		expiry:      now.Add(c.ttl),
+	}
+}
+
+// invalidate drops the user's entry. It must run after the change to their
+// grants has been committed, so that lookups starting later see it.
+func (c *PermissionsCache) invalidate(userID int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+	c.generation++
+}
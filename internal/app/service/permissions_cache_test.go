@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+func TestPermissionsCache(t *testing.T) {
+	t.Run("stores and returns a lookup", func(t *testing.T) {
+		c := NewPermissionsCache(time.Minute)
+
+		c.set(1, domain.Permissions{domain.PermissionProductsWrite}, c.currentGeneration())
+
+		got, ok := c.get(1)
+		if !ok || !PermissionsInclude(got, domain.PermissionProductsWrite) {
+			t.Fatalf("get = %v, %t, want the stored permissions", got, ok)
+		}
+	})
+
+	t.Run("invalidate drops the entry", func(t *testing.T) {
+		c := NewPermissionsCache(time.Minute)
+
+		c.set(1, domain.Permissions{domain.PermissionProductsWrite}, c.currentGeneration())
+		c.invalidate(1)
+
+		if got, ok := c.get(1); ok {
+			t.Fatalf("get = %v after invalidate, want a miss", got)
+		}
+	})
+
+	t.Run("lookup racing a revocation is not stored", func(t *testing.T) {
+		c := NewPermissionsCache(time.Minute)
+
+		// A lookup reads the old grants, then the revocation commits and
+		// invalidates before the lookup gets to store what it read.
+		generation := c.currentGeneration()
+		stale := domain.Permissions{domain.PermissionProductsWrite}
+		c.invalidate(1)
+		c.set(1, stale, generation)
+
+		if got, ok := c.get(1); ok {
+			t.Fatalf("get = %v, want the stale lookup discarded", got)
+		}
+
+		// The next lookup starts after the change and is cached again.
+		c.set(1, domain.Permissions{}, c.currentGeneration())
+		if _, ok := c.get(1); !ok {
+			t.Fatal("lookup after the revocation was not cached")
+		}
+	})
+
+	t.Run("expired entries miss", func(t *testing.T) {
+		c := NewPermissionsCache(time.Nanosecond)
+
+		c.set(1, domain.Permissions{domain.PermissionProductsWrite}, c.currentGeneration())
+		time.Sleep(time.Millisecond)
+
+		if got, ok := c.get(1); ok {
+			t.Fatalf("get = %v after expiry, want a miss", got)
+		}
+	})
+
+	t.Run("nil cache is disabled", func(t *testing.T) {
+		var c *PermissionsCache
+
+		c.set(1, domain.Permissions{domain.PermissionProductsWrite}, c.currentGeneration())
+		c.invalidate(1)
+
+		if _, ok := c.get(1); ok {
+			t.Fatal("nil cache returned an entry")
+		}
+	})
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/pkg/validation"
+)
+
+// personalAccessTokenPrefixLen is the number of plaintext characters kept in
+// the database so users can tell their tokens apart without exposing them.
+const personalAccessTokenPrefixLen = 8
+
+// defaultPersonalAccessTokenMaxTTLDays bounds token lifetimes for a service
+// built without a maximum of its own.
+const defaultPersonalAccessTokenMaxTTLDays = 365
+
+func generatePersonalAccessToken(userID int64, name string, codes []string, ttl time.Duration) (*domain.PersonalAccessToken, error) {
+	token := &domain.PersonalAccessToken{
+		UserID:      userID,
+		Name:        name,
+		Permissions: codes,
+	}
+
+	if ttl > 0 {
+		expiry := time.Now().Add(ttl)
+		token.Expiry = &expiry
+	}
+
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = domain.PersonalAccessTokenPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Prefix = token.Plaintext[:personalAccessTokenPrefixLen]
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+type PersonalAccessTokenService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+	TwoFactor    TwoFactorConfig
+	// MaxTTLDays is the longest lifetime a token may be given; zero means a
+	// year.
+	MaxTTLDays int
+}
+
+type CreatePersonalAccessTokenReq struct {
+	UserID      int64
+	Name        string
+	Permissions []string
+	// TTLDays is the token's lifetime in days, or zero for a token that
+	// doesn't expire.
+	TTLDays int
+}
+
+func (s PersonalAccessTokenService) New(ctx context.Context, req CreatePersonalAccessTokenReq) (*domain.PersonalAccessToken, error) {
+	var errs errsx.Map
+
+	name, err := domain.NewPersonalAccessTokenName(req.Name)
+	if err != nil {
+		errs.Set("name", err)
+	}
+	if len(req.Permissions) == 0 {
+		errs.Set("permissions", "must contain at least 1 permission")
+	}
+	if !validation.Unique(req.Permissions) {
+		errs.Set("permissions", "must not contain duplicate values")
+	}
+	maxTTLDays := s.MaxTTLDays
+	if maxTTLDays <= 0 {
+		maxTTLDays = defaultPersonalAccessTokenMaxTTLDays
+	}
+	switch {
+	case req.TTLDays < 0:
+		errs.Set("ttl_days", "must not be negative")
+	case req.TTLDays > maxTTLDays:
+		errs.Set("ttl_days", fmt.Sprintf("must not be more than %d", maxTTLDays))
+	}
+	if errs != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	// A token can never grant more than its owner currently holds.
+	granted, err := PermissionsService{DB: s.DB, QueryTimeout: s.QueryTimeout}.GetAllForUser(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range req.Permissions {
+		if !PermissionsInclude(granted, code) {
+			errs.Set("permissions", fmt.Sprintf("%q is not granted to the user", code))
+			return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+		}
+	}
+
+	// Nor can it carry a permission that needs two-factor authentication
+	// the owner hasn't set up, or it would sidestep enrolment.
+	twoFactor := TwoFactorService{DB: s.DB, QueryTimeout: s.QueryTimeout, Config: s.TwoFactor}
+	if twoFactor.RequiredFor(req.Permissions) {
+		enabled, err := twoFactor.Enabled(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !enabled {
+			errs.Set("permissions", "require two-factor authentication to be enabled first")
+			return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+		}
+	}
+
+	token, err := generatePersonalAccessToken(req.UserID, name, req.Permissions, time.Duration(req.TTLDays)*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO personal_access_tokens (user_id, name, prefix, hash, permissions, expiry)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at`
+
+	args := []any{token.UserID, token.Name, token.Prefix, token.Hash, pq.Array(token.Permissions), token.Expiry}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	err = s.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s PersonalAccessTokenService) GetAllForUser(ctx context.Context, userID int64) ([]domain.PersonalAccessToken, error) {
+	query := `
+        SELECT id, created_at, user_id, name, prefix, permissions, expiry, last_used_at
+        FROM personal_access_tokens
+        WHERE user_id = $1
+        ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []domain.PersonalAccessToken{}
+
+	for rows.Next() {
+		var token domain.PersonalAccessToken
+
+		err := rows.Scan(
+			&token.ID,
+			&token.CreatedAt,
+			&token.UserID,
+			&token.Name,
+			&token.Prefix,
+			pq.Array(&token.Permissions),
+			&token.Expiry,
+			&token.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (s PersonalAccessTokenService) Revoke(ctx context.Context, userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM personal_access_tokens
+        WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Authenticate resolves a plaintext personal access token to its owner and
+// records the time it was used.
+func (s PersonalAccessTokenService) Authenticate(ctx context.Context, tokenPlaintext string) (*domain.User, *domain.PersonalAccessToken, error) {
+	_, err := domain.NewPersonalAccessTokenPlaintext(tokenPlaintext)
+	if err != nil {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.has_password, users.activated, users.version,
+               personal_access_tokens.id, personal_access_tokens.created_at, personal_access_tokens.name,
+               personal_access_tokens.prefix, personal_access_tokens.permissions, personal_access_tokens.expiry,
+               personal_access_tokens.last_used_at
+        FROM users
+        INNER JOIN personal_access_tokens
+        ON users.id = personal_access_tokens.user_id
+        WHERE personal_access_tokens.hash = $1
+        AND (personal_access_tokens.expiry IS NULL OR personal_access_tokens.expiry > $2)`
+
+	var user domain.User
+	var token domain.PersonalAccessToken
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	err = s.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.HashedPassword,
+		&user.HasPassword,
+		&user.Activated,
+		&user.Version,
+		&token.ID,
+		&token.CreatedAt,
+		&token.Name,
+		&token.Prefix,
+		pq.Array(&token.Permissions),
+		&token.Expiry,
+		&token.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	token.UserID = user.ID
+	token.Hash = tokenHash[:]
+
+	// Only touch the row once a minute so busy automation doesn't turn every
+	// request into a write.
+	query = `
+        UPDATE personal_access_tokens
+        SET last_used_at = NOW()
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	_, err = s.DB.ExecContext(ctx, query, token.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, &token, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+func TestPersonalAccessTokenTTLValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxTTLDays int
+		ttlDays    int
+		want       string
+	}{
+		{"negative", 30, -1, "must not be negative"},
+		{"over the maximum", 30, 31, "must not be more than 30"},
+		// Days that would overflow a time.Duration into the past.
+		{"overflowing", 30, math.MaxInt, "must not be more than 30"},
+		{"over the default maximum", 0, defaultPersonalAccessTokenMaxTTLDays + 1, "must not be more than 365"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Validation fails before the database is needed.
+			s := PersonalAccessTokenService{MaxTTLDays: tt.maxTTLDays}
+
+			_, err := s.New(context.Background(), CreatePersonalAccessTokenReq{
+				UserID:      1,
+				Name:        "ci",
+				Permissions: []string{domain.PermissionProductsWrite},
+				TTLDays:     tt.ttlDays,
+			})
+
+			var errs errsx.Map
+			if !errors.Is(err, ErrBadRequest) || !errors.As(err, &errs) {
+				t.Fatalf("err = %v, want a validation error", err)
+			}
+			if got := errs.Get("ttl_days"); got != tt.want {
+				t.Errorf("ttl_days error = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersonalAccessTokenTTL(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := PersonalAccessTokenService{DB: db, MaxTTLDays: 30}
+
+	userID := insertTestUser(t, db, "tokens@example.com", "password", true)
+
+	_, err := db.ExecContext(ctx, `INSERT INTO users_roles SELECT $1, id FROM roles WHERE name = $2`, userID, domain.RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ttlDays := range []int{0, 30} {
+		token, err := s.New(ctx, CreatePersonalAccessTokenReq{
+			UserID:      userID,
+			Name:        "ci",
+			Permissions: []string{domain.PermissionReviewsWrite},
+			TTLDays:     ttlDays,
+		})
+		if err != nil {
+			t.Fatalf("ttl_days %d: %v", ttlDays, err)
+		}
+
+		switch {
+		case ttlDays == 0 && token.Expiry != nil:
+			t.Errorf("ttl_days 0: expiry = %v, want none", token.Expiry)
+		case ttlDays > 0 && (token.Expiry == nil || !token.Expiry.After(token.CreatedAt)):
+			t.Errorf("ttl_days %d: expiry = %v, want after %v", ttlDays, token.Expiry, token.CreatedAt)
+		}
+	}
+}
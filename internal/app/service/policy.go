@@ -0,0 +1,125 @@
+package service
+
+import (
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Principal is the user an authorization decision is made for, together with
+// their effective permissions.
+type Principal struct {
+	User        *domain.User
+	Permissions domain.Permissions
+}
+
+// Has reports whether p holds the permission code.
+func (p Principal) Has(code string) bool {
+	return PermissionsInclude(p.Permissions, code)
+}
+
+// Scoped narrows p to the permissions a personal access token was minted
+// with.
+func (p Principal) Scoped(token *domain.PersonalAccessToken) Principal {
+	return p.Without(func(code string) bool {
+		return !PermissionsInclude(token.Permissions, code)
+	})
+}
+
+// Without drops the permissions for which withhold reports true.
+func (p Principal) Without(withhold func(code string) bool) Principal {
+	var kept domain.Permissions
+	for _, code := range p.Permissions {
+		if !withhold(code) {
+			kept = append(kept, code)
+		}
+	}
+
+	return Principal{User: p.User, Permissions: kept}
+}
+
+func (p Principal) owns(userID int64) bool {
+	return p.User != nil && !IsAnonymous(p.User) && p.User.ID == userID
+}
+
+// Can reports whether p may perform action on resource. Permission codes grant
+// access across the board; without them users may only reach what they own.
+// Resources of an unknown type are always denied.
+func Can(p Principal, action string, resource any) bool {
+	switch resource := resource.(type) {
+	case *domain.Product:
+		return canProduct(p, action, resource)
+	case *domain.Order:
+		return canOrder(p, action, resource)
+	case *domain.Invoice:
+		return canInvoice(p, action, resource)
+	case *domain.Review:
+		return canReview(p, action, resource)
+	default:
+		return false
+	}
+}
+
+func canProduct(p Principal, action string, product *domain.Product) bool {
+	switch action {
+	case ActionRead:
+		return true
+	case ActionCreate:
+		return p.Has(domain.PermissionProductsWrite) || p.Has(domain.PermissionProductsPublish)
+	case ActionUpdate, ActionDelete:
+		if p.Has(domain.PermissionProductsWrite) {
+			return true
+		}
+		return p.Has(domain.PermissionProductsPublish) && product.PublisherID != nil && p.owns(*product.PublisherID)
+	default:
+		return false
+	}
+}
+
+func canOrder(p Principal, action string, order *domain.Order) bool {
+	switch action {
+	case ActionRead:
+		return p.Has(domain.PermissionOrdersRead) || p.owns(order.UserID)
+	case ActionCreate:
+		return p.owns(order.UserID)
+	case ActionUpdate:
+		return p.Has(domain.PermissionOrdersWrite)
+	case ActionDelete:
+		// Customers may cancel their own orders until they are being worked on.
+		if p.Has(domain.PermissionOrdersWrite) {
+			return true
+		}
+		return p.owns(order.UserID) && order.Status == domain.OrderStatusNew
+	default:
+		return false
+	}
+}
+
+func canInvoice(p Principal, action string, invoice *domain.Invoice) bool {
+	switch action {
+	case ActionRead:
+		return p.Has(domain.PermissionInvoicesRead) || p.owns(invoice.UserID)
+	case ActionCreate, ActionUpdate, ActionDelete:
+		return p.Has(domain.PermissionInvoicesWrite)
+	default:
+		return false
+	}
+}
+
+func canReview(p Principal, action string, review *domain.Review) bool {
+	switch action {
+	case ActionRead:
+		return true
+	case ActionCreate, ActionUpdate:
+		return p.Has(domain.PermissionReviewsWrite) && p.owns(review.UserID)
+	case ActionDelete:
+		return p.Has(domain.PermissionReviewsModerate) || p.owns(review.UserID)
+	default:
+		return false
+	}
+}
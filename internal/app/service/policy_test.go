@@ -0,0 +1,170 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+func TestCan(t *testing.T) {
+	owner := &domain.User{ID: 1, Activated: true}
+	other := &domain.User{ID: 2, Activated: true}
+
+	principal := func(user *domain.User, codes ...string) Principal {
+		return Principal{User: user, Permissions: codes}
+	}
+
+	ownerID := owner.ID
+	otherID := other.ID
+	publishedByOwner := &domain.Product{ID: 10, PublisherID: &ownerID}
+	publishedByOther := &domain.Product{ID: 11, PublisherID: &otherID}
+	catalogue := &domain.Product{ID: 12}
+
+	orderWithStatus := func(status domain.OrderStatus) *domain.Order {
+		return &domain.Order{ID: 20, UserID: owner.ID, Status: status}
+	}
+
+	invoice := &domain.Invoice{ID: 30, UserID: owner.ID}
+	review := &domain.Review{ID: 40, UserID: owner.ID}
+
+	tests := []struct {
+		name      string
+		principal Principal
+		action    string
+		resource  any
+		want      bool
+	}{
+		// Products
+		{"anyone reads a product", principal(AnonymousUser), ActionRead, catalogue, true},
+		{"products:write creates", principal(other, domain.PermissionProductsWrite), ActionCreate, &domain.Product{}, true},
+		{"products:publish creates", principal(other, domain.PermissionProductsPublish), ActionCreate, &domain.Product{}, true},
+		{"no permission can't create", principal(other), ActionCreate, &domain.Product{}, false},
+		{"products:write updates any product", principal(other, domain.PermissionProductsWrite), ActionUpdate, publishedByOwner, true},
+		{"products:write deletes catalogue products", principal(other, domain.PermissionProductsWrite), ActionDelete, catalogue, true},
+		{"publisher updates their own product", principal(owner, domain.PermissionProductsPublish), ActionUpdate, publishedByOwner, true},
+		{"publisher deletes their own product", principal(owner, domain.PermissionProductsPublish), ActionDelete, publishedByOwner, true},
+		{"publisher can't update someone else's product", principal(owner, domain.PermissionProductsPublish), ActionUpdate, publishedByOther, false},
+		{"publisher can't delete someone else's product", principal(owner, domain.PermissionProductsPublish), ActionDelete, publishedByOther, false},
+		{"publisher can't update catalogue products", principal(owner, domain.PermissionProductsPublish), ActionUpdate, catalogue, false},
+		{"owner without products:publish can't update", principal(owner), ActionUpdate, publishedByOwner, false},
+		{"unknown product action is denied", principal(owner, domain.PermissionProductsWrite), "archive", catalogue, false},
+
+		// Orders
+		{"owner reads their order", principal(owner), ActionRead, orderWithStatus(domain.OrderStatusNew), true},
+		{"non-owner can't read an order", principal(other), ActionRead, orderWithStatus(domain.OrderStatusNew), false},
+		{"orders:read reads any order", principal(other, domain.PermissionOrdersRead), ActionRead, orderWithStatus(domain.OrderStatusNew), true},
+		{"owner places their order", principal(owner), ActionCreate, orderWithStatus(domain.OrderStatusNew), true},
+		{"no one places an order for someone else", principal(other, domain.PermissionOrdersWrite), ActionCreate, orderWithStatus(domain.OrderStatusNew), false},
+		{"owner can't update their order", principal(owner), ActionUpdate, orderWithStatus(domain.OrderStatusNew), false},
+		{"orders:write updates any order", principal(other, domain.PermissionOrdersWrite), ActionUpdate, orderWithStatus(domain.OrderStatusInProgress), true},
+		{"owner cancels a new order", principal(owner), ActionDelete, orderWithStatus(domain.OrderStatusNew), true},
+		{"owner can't cancel an order in progress", principal(owner), ActionDelete, orderWithStatus(domain.OrderStatusInProgress), false},
+		{"owner can't cancel a delivered order", principal(owner), ActionDelete, orderWithStatus(domain.OrderStatusDelivered), false},
+		{"owner can't cancel a cancelled order", principal(owner), ActionDelete, orderWithStatus(domain.OrderStatusCancelled), false},
+		{"non-owner can't cancel a new order", principal(other), ActionDelete, orderWithStatus(domain.OrderStatusNew), false},
+		{"orders:write cancels an order in progress", principal(other, domain.PermissionOrdersWrite), ActionDelete, orderWithStatus(domain.OrderStatusInProgress), true},
+		{"orders:read can't cancel", principal(other, domain.PermissionOrdersRead), ActionDelete, orderWithStatus(domain.OrderStatusNew), false},
+
+		// Invoices
+		{"owner reads their invoice", principal(owner), ActionRead, invoice, true},
+		{"non-owner can't read an invoice", principal(other), ActionRead, invoice, false},
+		{"invoices:read reads any invoice", principal(other, domain.PermissionInvoicesRead), ActionRead, invoice, true},
+		{"owner can't update their invoice", principal(owner), ActionUpdate, invoice, false},
+		{"invoices:write creates invoices", principal(other, domain.PermissionInvoicesWrite), ActionCreate, invoice, true},
+		{"invoices:read can't delete", principal(other, domain.PermissionInvoicesRead), ActionDelete, invoice, false},
+
+		// Reviews
+		{"anyone reads a review", principal(AnonymousUser), ActionRead, review, true},
+		{"reviews:write creates their own review", principal(owner, domain.PermissionReviewsWrite), ActionCreate, review, true},
+		{"reviews:write can't create a review as someone else", principal(other, domain.PermissionReviewsWrite), ActionCreate, review, false},
+		{"owner without reviews:write can't create", principal(owner), ActionCreate, review, false},
+		{"reviews:write updates their own review", principal(owner, domain.PermissionReviewsWrite), ActionUpdate, review, true},
+		{"moderator can't update someone else's review", principal(other, domain.PermissionReviewsWrite, domain.PermissionReviewsModerate), ActionUpdate, review, false},
+		{"owner deletes their own review", principal(owner), ActionDelete, review, true},
+		{"non-owner can't delete a review", principal(other, domain.PermissionReviewsWrite), ActionDelete, review, false},
+		{"moderator deletes any review", principal(other, domain.PermissionReviewsModerate), ActionDelete, review, true},
+
+		// Anonymous users own nothing, even records whose owner is unset.
+		{"anonymous can't read an ownerless order", principal(AnonymousUser), ActionRead, &domain.Order{}, false},
+		{"anonymous can't delete an ownerless review", principal(AnonymousUser), ActionDelete, &domain.Review{}, false},
+
+		// Unknown resources
+		{"unknown resource is denied", principal(owner, domain.PermissionProductsWrite), ActionRead, owner, false},
+		{"nil resource is denied", principal(owner), ActionRead, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Can(tt.principal, tt.action, tt.resource)
+			if got != tt.want {
+				t.Errorf("Can(%v, %q, %T) = %t, want %t", tt.principal.Permissions, tt.action, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanScopedToToken(t *testing.T) {
+	user := &domain.User{ID: 1, Activated: true}
+	other := int64(2)
+
+	p := Principal{
+		User:        user,
+		Permissions: domain.Permissions{domain.PermissionProductsWrite, domain.PermissionOrdersRead},
+	}
+
+	tests := []struct {
+		name     string
+		token    domain.Permissions
+		action   string
+		resource any
+		want     bool
+	}{
+		{"token carrying products:write updates products", domain.Permissions{domain.PermissionProductsWrite}, ActionUpdate, &domain.Product{PublisherID: &other}, true},
+		{"token without products:write can't update products", domain.Permissions{domain.PermissionOrdersRead}, ActionUpdate, &domain.Product{PublisherID: &other}, false},
+		{"token carrying orders:read reads any order", domain.Permissions{domain.PermissionOrdersRead}, ActionRead, &domain.Order{UserID: other}, true},
+		{"token without orders:read can't read other orders", domain.Permissions{domain.PermissionProductsWrite}, ActionRead, &domain.Order{UserID: other}, false},
+		// Ownership comes from the user, not from a permission, so it
+		// survives any scope.
+		{"token still reaches the owner's own orders", domain.Permissions{domain.PermissionProductsWrite}, ActionRead, &domain.Order{UserID: user.ID}, true},
+		// A token can't grant what its owner no longer holds.
+		{"token permission the owner lost doesn't count", domain.Permissions{domain.PermissionInvoicesRead}, ActionRead, &domain.Invoice{UserID: other}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoped := p.Scoped(&domain.PersonalAccessToken{Permissions: tt.token})
+
+			got := Can(scoped, tt.action, tt.resource)
+			if got != tt.want {
+				t.Errorf("Can(%v, %q, %T) = %t, want %t", scoped.Permissions, tt.action, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalWithout(t *testing.T) {
+	twoFactor := TwoFactorService{Config: TwoFactorConfig{RequiredPermissions: []string{domain.PermissionProductsWrite}}}
+
+	p := Principal{
+		User:        &domain.User{ID: 1},
+		Permissions: domain.Permissions{domain.PermissionProductsWrite, domain.PermissionProductsPublish},
+	}
+
+	withheld := p.Without(twoFactor.RequiredForPermission)
+
+	if withheld.Has(domain.PermissionProductsWrite) {
+		t.Error("products:write was not withheld")
+	}
+	if !withheld.Has(domain.PermissionProductsPublish) {
+		t.Error("products:publish was withheld")
+	}
+	if !p.Has(domain.PermissionProductsWrite) {
+		t.Error("Without changed the original principal")
+	}
+
+	// Losing products:write leaves only what the user publishes.
+	other := int64(2)
+	if Can(withheld, ActionUpdate, &domain.Product{PublisherID: &other}) {
+		t.Error("principal without products:write updated someone else's product")
+	}
+}
@@ -5,23 +5,30 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
 	"time"
 )
 
 type ProductService struct {
-	DB *sql.DB
+	DB           *sql.DB
+	QueryTimeout time.Duration
 }
 
-func (s ProductService) GetAll(title string, filters Filters) ([]domain.Product, Metadata, error) {
+func (s ProductService) GetAll(ctx context.Context, title string, filters Filters) ([]domain.Product, Metadata, error) {
+	if err := filters.Validate(nil); err != nil {
+		return nil, Metadata{}, fmt.Errorf("%w: %w", ErrBadRequest, err)
+	}
+
 	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, created_at, title, description, price, version
+        SELECT count(*) OVER(), id, created_at, title, description, price, publisher_id, version
         FROM products
         WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')   
         ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+        LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
 	args := []any{title, filters.limit(), filters.offset()}
@@ -46,6 +53,7 @@ func (s ProductService) GetAll(title string, filters Filters) ([]domain.Product,
 			&product.Title,
 			&product.Description,
 			&product.Price,
+			&product.PublisherID,
 			&product.Version,
 		)
 		if err != nil {
@@ -64,10 +72,32 @@ func (s ProductService) GetAll(title string, filters Filters) ([]domain.Product,
 	return products, metadata, nil
 }
 
+func validateProduct(title, description string, price int32) error {
+	var errs errsx.Map
+
+	if _, err := domain.NewProductTitle(title); err != nil {
+		errs.Set("title", err)
+	}
+	if _, err := domain.NewProductDescription(description); err != nil {
+		errs.Set("description", err)
+	}
+	if _, err := domain.NewProductPrice(price); err != nil {
+		errs.Set("price", err)
+	}
+
+	if errs != nil {
+		return fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	return nil
+}
+
 type CreateProductReq struct {
+	Actor       domain.AuditActor
 	Title       string
 	Description string
 	Price       int32
+	PublisherID *int64
 }
 
 type CreateProductRes struct {
@@ -76,20 +106,48 @@ type CreateProductRes struct {
 	Version   int32
 }
 
-func (s ProductService) CreateProduct(req CreateProductReq) (*CreateProductRes, error) {
-	//todo: validate the input
+func (s ProductService) CreateProduct(ctx context.Context, req CreateProductReq) (*CreateProductRes, error) {
+	err := validateProduct(req.Title, req.Description, req.Price)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-        INSERT INTO products (title, description, price) 
-        VALUES ($1, $2, $3)
+        INSERT INTO products (title, description, price, publisher_id) 
+        VALUES ($1, $2, $3, $4)
         RETURNING id, created_at, version`
 
-	args := []any{req.Title, req.Description, req.Price}
+	args := []any{req.Title, req.Description, req.Price, req.PublisherID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	var res CreateProductRes
-	err := s.DB.QueryRowContext(ctx, query, args...).Scan(&res.ID, &res.CreatedAt, &res.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&res.ID, &res.CreatedAt, &res.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	event := newAuditEvent(req.Actor, domain.AuditActionProductCreated, domain.AuditTargetProduct, res.ID)
+	event.After = productAuditFields(domain.Product{
+		Title:       req.Title,
+		Description: req.Description,
+		Price:       req.Price,
+		PublisherID: req.PublisherID,
+	})
+
+	err = insertAuditEvent(ctx, tx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
@@ -97,30 +155,45 @@ func (s ProductService) CreateProduct(req CreateProductReq) (*CreateProductRes,
 	return &res, nil
 }
 
-func (s ProductService) Get(id int64) (*domain.Product, error) {
+func (s ProductService) Get(ctx context.Context, id int64) (*domain.Product, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-        SELECT id, created_at, title, description, price, version
+        SELECT id, created_at, title, description, price, publisher_id, version
         FROM products
         WHERE id = $1`
 
-	var product domain.Product
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
-	err := s.DB.QueryRowContext(ctx, query, id).Scan(
+	return scanProduct(s.DB.QueryRowContext(ctx, query, id))
+}
+
+// getForUpdate loads and locks a product for the rest of tx.
+func (s ProductService) getForUpdate(ctx context.Context, tx *sql.Tx, id int64) (*domain.Product, error) {
+	query := `
+        SELECT id, created_at, title, description, price, publisher_id, version
+        FROM products
+        WHERE id = $1
+        FOR UPDATE`
+
+	return scanProduct(tx.QueryRowContext(ctx, query, id))
+}
+
+func scanProduct(row *sql.Row) (*domain.Product, error) {
+	var product domain.Product
+
+	err := row.Scan(
 		&product.ID,
 		&product.CreatedAt,
 		&product.Title,
 		&product.Description,
 		&product.Price,
+		&product.PublisherID,
 		&product.Version,
 	)
-
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -133,7 +206,23 @@ func (s ProductService) Get(id int64) (*domain.Product, error) {
 	return &product, nil
 }
 
+func productAuditFields(product domain.Product) map[string]any {
+	fields := map[string]any{
+		"title":        product.Title,
+		"description":  product.Description,
+		"price":        product.Price,
+		"publisher_id": nil,
+	}
+
+	if product.PublisherID != nil {
+		fields["publisher_id"] = *product.PublisherID
+	}
+
+	return fields
+}
+
 type UpdateProductReq struct {
+	Actor       domain.AuditActor
 	ID          int64
 	Title       string
 	Description string
@@ -145,12 +234,39 @@ type UpdateProductRes struct {
 	Version int32
 }
 
-func (s ProductService) Update(req UpdateProductReq) (*UpdateProductRes, error) {
-	// todo: validate the input
+func (s ProductService) Update(ctx context.Context, req UpdateProductReq) (*UpdateProductRes, error) {
+	err := validateProduct(req.Title, req.Description, req.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := s.getForUpdate(ctx, tx, req.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	if before.Version != req.Version {
+		return nil, ErrEditConflict
+	}
+
 	query := `
         UPDATE products 
         SET title = $1, description = $2, price = $3, version = version + 1
-        WHERE id = $4 AND version = $5
+        WHERE id = $4
         RETURNING version`
 
 	args := []any{
@@ -158,51 +274,72 @@ func (s ProductService) Update(req UpdateProductReq) (*UpdateProductRes, error)
 		req.Description,
 		req.Price,
 		req.ID,
-		req.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	var res UpdateProductRes
-	err := s.DB.QueryRowContext(ctx, query, args...).Scan(&res.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&res.Version)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrEditConflict
-		default:
-			return nil, err
-		}
+		return nil, err
+	}
+
+	after := *before
+	after.Title, after.Description, after.Price = req.Title, req.Description, req.Price
+
+	event := newAuditEvent(req.Actor, domain.AuditActionProductUpdated, domain.AuditTargetProduct, req.ID)
+	event.Before, event.After = auditDiff(productAuditFields(*before), productAuditFields(after))
+
+	err = insertAuditEvent(ctx, tx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
 	}
 
 	return &res, nil
 }
 
-func (s ProductService) Delete(id int64) error {
+// Delete removes a product that has never been ordered; a product with
+// orders is kept for their history and ErrProductOrdered is returned.
+func (s ProductService) Delete(ctx context.Context, actor domain.AuditActor, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `
-        DELETE FROM products
-        WHERE id = $1`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
-	result, err := s.DB.ExecContext(ctx, query, id)
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	before, err := s.getForUpdate(ctx, tx, id)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	_, err = tx.ExecContext(ctx, `DELETE FROM products WHERE id = $1`, id)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrProductOrdered
+		default:
+			return err
+		}
 	}
 
-	return nil
+	event := newAuditEvent(actor, domain.AuditActionProductDeleted, domain.AuditTargetProduct, id)
+	event.Before = productAuditFields(*before)
+
+	err = insertAuditEvent(ctx, tx, event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+func TestProductDeleteKeepsOrderedProducts(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := ProductService{DB: db}
+
+	userID := insertTestUser(t, db, "buyer@example.com", "password", true)
+	actor := domain.AuditActor{UserID: userID}
+
+	insertProduct := func(title string) int64 {
+		t.Helper()
+
+		var id int64
+		err := db.QueryRowContext(ctx, `
+            INSERT INTO products (title, description, price)
+            VALUES ($1, '', 1000)
+            RETURNING id`, title).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	orderedID := insertProduct("Ordered")
+	unorderedID := insertProduct("Never ordered")
+
+	var orderID int64
+	err := db.QueryRowContext(ctx, `
+        INSERT INTO orders (user_id, status, total_price)
+        VALUES ($1, $2, 1000)
+        RETURNING id`, userID, domain.OrderStatusNew).Scan(&orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.ExecContext(ctx, `INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, 1, 1000)`, orderID, orderedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Delete(ctx, actor, orderedID)
+	if !errors.Is(err, ErrProductOrdered) {
+		t.Fatalf("deleting an ordered product: err = %v, want ErrProductOrdered", err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM order_items WHERE order_id = $1`, orderID); n != 1 {
+		t.Errorf("order has %d items after the refused delete, want 1", n)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM products WHERE id = $1`, orderedID); n != 1 {
+		t.Error("ordered product was deleted")
+	}
+
+	err = s.Delete(ctx, actor, unorderedID)
+	if err != nil {
+		t.Fatalf("deleting a product without orders: %v", err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM products WHERE id = $1`, unorderedID); n != 0 {
+		t.Error("product without orders was kept")
+	}
+}
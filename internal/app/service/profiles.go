@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/pkg/passwordhash"
+	"github.com/ruhollahh/paperback/pkg/passwordpolicy"
+)
+
+type ProfileService struct {
+	DB           *sql.DB
+	Passwords    *passwordpolicy.Policy
+	Hasher       *passwordhash.Hasher
+	QueryTimeout time.Duration
+}
+
+func (s ProfileService) Get(ctx context.Context, userID int64) (*domain.Profile, error) {
+	query := `
+        SELECT id, name, email, phone, language, notify_orders, notify_newsletter, version
+        FROM users
+        WHERE id = $1`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	return scanProfile(s.DB.QueryRowContext(ctx, query, userID))
+}
+
+func scanProfile(row *sql.Row) (*domain.Profile, error) {
+	var profile domain.Profile
+
+	err := row.Scan(
+		&profile.UserID,
+		&profile.Name,
+		&profile.Email,
+		&profile.Phone,
+		&profile.Language,
+		&profile.NotifyOrders,
+		&profile.NotifyNewsletter,
+		&profile.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &profile, nil
+}
+
+func profileAuditFields(profile domain.Profile) map[string]any {
+	return map[string]any{
+		"name":              profile.Name,
+		"phone":             profile.Phone,
+		"language":          profile.Language,
+		"notify_orders":     profile.NotifyOrders,
+		"notify_newsletter": profile.NotifyNewsletter,
+	}
+}
+
+type UpdateProfileReq struct {
+	Actor            domain.AuditActor
+	UserID           int64
+	Name             string
+	Phone            string
+	Language         string
+	NotifyOrders     bool
+	NotifyNewsletter bool
+	Version          int32
+}
+
+func (s ProfileService) Update(ctx context.Context, req UpdateProfileReq) (*domain.Profile, error) {
+	var errs errsx.Map
+
+	name, err := domain.NewName(req.Name)
+	if err != nil {
+		errs.Set("name", err)
+	}
+
+	phone, err := domain.NewPhone(req.Phone)
+	if err != nil {
+		errs.Set("phone", err)
+	}
+
+	language, err := domain.NewLanguage(req.Language)
+	if err != nil {
+		errs.Set("language", err)
+	}
+
+	if errs != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT id, name, email, phone, language, notify_orders, notify_newsletter, version
+        FROM users
+        WHERE id = $1
+        FOR UPDATE`
+
+	before, err := scanProfile(tx.QueryRowContext(ctx, query, req.UserID))
+	if err != nil {
+		return nil, err
+	}
+
+	if before.Version != req.Version {
+		return nil, ErrEditConflict
+	}
+
+	after := *before
+	after.Name = name
+	after.Phone = phone
+	after.Language = language
+	after.NotifyOrders = req.NotifyOrders
+	after.NotifyNewsletter = req.NotifyNewsletter
+
+	query = `
+        UPDATE users
+        SET name = $1, phone = $2, language = $3, notify_orders = $4, notify_newsletter = $5, version = version + 1
+        WHERE id = $6
+        RETURNING version`
+
+	args := []any{after.Name, after.Phone, after.Language, after.NotifyOrders, after.NotifyNewsletter, after.UserID}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&after.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	event := newAuditEvent(req.Actor, domain.AuditActionProfileUpdated, domain.AuditTargetUser, req.UserID)
+	event.Before, event.After = auditDiff(profileAuditFields(*before), profileAuditFields(after))
+
+	err = insertAuditEvent(ctx, tx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+type ChangePasswordReq struct {
+	Actor           domain.AuditActor
+	UserID          int64
+	CurrentPassword string
+	NewPassword     string
+	Version         int32
+	// AuthenticatedAt is when the user last signed in, which stands in for
+	// the current password of users who don't have one yet.
+	AuthenticatedAt time.Time
+	// KeepSessionToken is the session the change was made from; every other
+	// session of the user is ended with the change.
+	KeepSessionToken string
+}
+
+// ChangePassword replaces the user's password after checking the current one
+// and returns the account's new version. Anyone holding the old password may
+// hold other sessions too, so those are ended in the same transaction. Users
+// who signed up with an external identity set their first password this way.
+func (s ProfileService) ChangePassword(ctx context.Context, req ChangePasswordReq) (int32, error) {
+	var errs errsx.Map
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT name, email, password_hash, has_password, version
+        FROM users
+        WHERE id = $1
+        FOR UPDATE`
+
+	var user domain.User
+
+	err = tx.QueryRowContext(ctx, query, req.UserID).Scan(&user.Name, &user.Email, &user.HashedPassword, &user.HasPassword, &user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	if user.Version != req.Version {
+		return 0, ErrEditConflict
+	}
+
+	if user.HasPassword && req.CurrentPassword == "" {
+		errs.Set("current_password", "must be provided")
+		return 0, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	err = confirmIdentity(s.Hasher, &user, req.CurrentPassword, req.AuthenticatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	err = validatePassword(s.Passwords, &errs, "new_password", req.NewPassword, user.Name, user.Email)
+	if err != nil {
+		return 0, err
+	}
+	if errs != nil {
+		return 0, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	var p password
+	err = p.Set(s.Hasher, req.NewPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+        UPDATE users
+        SET password_hash = $1, has_password = true, version = version + 1
+        WHERE id = $2
+        RETURNING version`
+
+	var version int32
+	err = tx.QueryRowContext(ctx, query, p.hash, req.UserID).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertAuditEvent(ctx, tx, newAuditEvent(req.Actor, domain.AuditActionPasswordChanged, domain.AuditTargetUser, req.UserID))
+	if err != nil {
+		return 0, err
+	}
+
+	err = revokeSessions(ctx, tx, req.UserID, req.KeepSessionToken)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/passwordpolicy"
+)
+
+func TestProfileUpdateRefusesStaleVersion(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := ProfileService{DB: db}
+
+	userID := insertTestUser(t, db, "profile@example.com", "password", true)
+
+	profile, err := s.Get(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(name string) (*domain.Profile, error) {
+		return s.Update(ctx, UpdateProfileReq{
+			Actor:    domain.AuditActor{UserID: userID},
+			UserID:   userID,
+			Name:     name,
+			Language: profile.Language,
+			Version:  profile.Version,
+		})
+	}
+
+	// Two tabs load the same version; the first save wins.
+	updated, err := update("First tab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != profile.Version+1 {
+		t.Errorf("version = %d, want %d", updated.Version, profile.Version+1)
+	}
+
+	_, err = update("Second tab")
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("err = %v, want ErrEditConflict", err)
+	}
+
+	got, err := s.Get(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "First tab" || got.Version != updated.Version {
+		t.Errorf("profile = %q at version %d, want %q at version %d", got.Name, got.Version, "First tab", updated.Version)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := ProfileService{DB: db, Hasher: testHasher, Passwords: passwordpolicy.New(passwordpolicy.Config{MinLength: 8})}
+	sessions := SessionService{DB: db}
+
+	userID := insertTestUser(t, db, "sessions@example.com", "old password", true)
+
+	for _, token := range []string{"current", "laptop", "phone"} {
+		_, err := db.ExecContext(ctx, `INSERT INTO sessions (token, data, expiry) VALUES ($1, '\x00', NOW() + INTERVAL '1 day')`, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sessions.Register(ctx, RegisterSessionReq{Token: token, UserID: userID, IP: "192.0.2.1", UserAgent: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	profile, err := s.Get(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.ChangePassword(ctx, ChangePasswordReq{
+		Actor:            domain.AuditActor{UserID: userID},
+		UserID:           userID,
+		CurrentPassword:  "old password",
+		NewPassword:      "a brand new passphrase",
+		Version:          profile.Version,
+		KeepSessionToken: "current",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"sessions", "user_sessions"} {
+		if n := countRows(t, db, `SELECT COUNT(*) FROM `+table+` WHERE token <> 'current'`); n != 0 {
+			t.Errorf("%d other sessions left in %s, want none", n, table)
+		}
+		if n := countRows(t, db, `SELECT COUNT(*) FROM `+table+` WHERE token = 'current'`); n != 1 {
+			t.Errorf("current session missing from %s", table)
+		}
+	}
+}
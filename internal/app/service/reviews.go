@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+)
+
+type ReviewService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+func validateReview(rating int32, body string) error {
+	var errs errsx.Map
+
+	if _, err := domain.NewReviewRating(rating); err != nil {
+		errs.Set("rating", err)
+	}
+	if _, err := domain.NewReviewBody(body); err != nil {
+		errs.Set("body", err)
+	}
+
+	if errs != nil {
+		return fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	return nil
+}
+
+type CreateReviewReq struct {
+	ProductID int64
+	UserID    int64
+	Rating    int32
+	Body      string
+}
+
+func (s ReviewService) Create(ctx context.Context, req CreateReviewReq) (*domain.Review, error) {
+	err := validateReview(req.Rating, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO reviews (product_id, user_id, rating, body)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, version`
+
+	review := domain.Review{
+		ProductID: req.ProductID,
+		UserID:    req.UserID,
+		Rating:    req.Rating,
+		Body:      req.Body,
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	err = s.DB.QueryRowContext(ctx, query, review.ProductID, review.UserID, review.Rating, review.Body).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.Version,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_product_id_user_id_key"`:
+			return nil, ErrDuplicateReview
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+func (s ReviewService) Get(ctx context.Context, id int64) (*domain.Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, product_id, user_id, rating, body, version
+        FROM reviews
+        WHERE id = $1`
+
+	var review domain.Review
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.ProductID,
+		&review.UserID,
+		&review.Rating,
+		&review.Body,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+func (s ReviewService) GetAllForUser(ctx context.Context, userID int64) ([]domain.Review, error) {
+	query := `
+        SELECT id, created_at, product_id, user_id, rating, body, version
+        FROM reviews
+        WHERE user_id = $1
+        ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []domain.Review{}
+
+	for rows.Next() {
+		var review domain.Review
+
+		err := rows.Scan(
+			&review.ID,
+			&review.CreatedAt,
+			&review.ProductID,
+			&review.UserID,
+			&review.Rating,
+			&review.Body,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+type UpdateReviewReq struct {
+	ID      int64
+	Rating  int32
+	Body    string
+	Version int32
+}
+
+func (s ReviewService) Update(ctx context.Context, req UpdateReviewReq) (int32, error) {
+	err := validateReview(req.Rating, req.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+        UPDATE reviews
+        SET rating = $1, body = $2, version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING version`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	var version int32
+	err = s.DB.QueryRowContext(ctx, query, req.Rating, req.Body, req.ID, req.Version).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrEditConflict
+		default:
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
+
+func (s ReviewService) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM reviews
+        WHERE id = $1`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
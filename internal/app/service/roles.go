@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+type RoleService struct {
+	DB           *sql.DB
+	Cache        *PermissionsCache
+	QueryTimeout time.Duration
+}
+
+func (s RoleService) GetAll(ctx context.Context) ([]domain.Role, error) {
+	query := `
+        SELECT roles.id, roles.name, COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+        FROM roles
+        LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+        LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+        GROUP BY roles.id
+        ORDER BY roles.id`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []domain.Role{}
+
+	for rows.Next() {
+		var role domain.Role
+
+		err := rows.Scan(&role.ID, &role.Name, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (s RoleService) GetAllForUser(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+        SELECT roles.name
+        FROM roles
+        INNER JOIN users_roles ON users_roles.role_id = roles.id
+        WHERE users_roles.user_id = $1
+        ORDER BY roles.id`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+
+	for rows.Next() {
+		var role string
+
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (s RoleService) names(ctx context.Context) ([]string, error) {
+	roles, err := s.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(roles))
+	for i := range roles {
+		names[i] = roles[i].Name
+	}
+
+	return names, nil
+}
+
+type ChangeRolesReq struct {
+	Actor  domain.AuditActor
+	UserID int64
+	Roles  []string
+}
+
+func (s RoleService) GrantForUser(ctx context.Context, req ChangeRolesReq) error {
+	catalogue, err := s.names(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = validateNames("roles", req.Roles, catalogue)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO users_roles
+        SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+        ON CONFLICT DO NOTHING`
+
+	defer s.Cache.invalidate(req.UserID)
+
+	return changeGrants(ctx, s.DB, s.QueryTimeout, query, req.Actor, req.UserID, req.Roles, domain.AuditActionRolesGranted)
+}
+
+func (s RoleService) RevokeForUser(ctx context.Context, req ChangeRolesReq) error {
+	catalogue, err := s.names(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = validateNames("roles", req.Roles, catalogue)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        DELETE FROM users_roles
+        USING roles
+        WHERE users_roles.role_id = roles.id AND users_roles.user_id = $1 AND roles.name = ANY($2)`
+
+	defer s.Cache.invalidate(req.UserID)
+
+	return changeGrants(ctx, s.DB, s.QueryTimeout, query, req.Actor, req.UserID, req.Roles, domain.AuditActionRolesRevoked)
+}
+
+// addDefaultRole gives a newly created user the customer role.
+func addDefaultRole(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+        INSERT INTO users_roles
+        SELECT $1, roles.id FROM roles WHERE roles.name = $2`
+
+	_, err := tx.ExecContext(ctx, query, userID, domain.RoleCustomer)
+	return err
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ruhollahh/paperback/internal/testdb"
+	"github.com/ruhollahh/paperback/pkg/passwordhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHasher keeps hashing cheap; the cost doesn't matter to these tests.
+var testHasher = passwordhash.New(passwordhash.Config{BcryptCost: bcrypt.MinCost})
+
+// newTestDB returns a fresh, fully migrated database; see testdb.New.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	return testdb.New(t)
+}
+
+// insertTestUser adds a user with the given password directly, skipping the
+// checks signup would make.
+func insertTestUser(t *testing.T, db *sql.DB, email, plaintextPassword string, activated bool) int64 {
+	t.Helper()
+
+	var p password
+	err := p.Set(testHasher, plaintextPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id int64
+	err = db.QueryRowContext(context.Background(), `
+        INSERT INTO users (name, email, password_hash, activated)
+        VALUES ('Test user', $1, $2, $3)
+        RETURNING id`, email, p.hash, activated).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+
+	var n int
+	err := db.QueryRowContext(context.Background(), query, args...).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
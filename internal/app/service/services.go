@@ -3,24 +3,75 @@ package service
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	"github.com/ruhollahh/paperback/pkg/passwordhash"
+	"github.com/ruhollahh/paperback/pkg/passwordpolicy"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Services struct {
-	Tokens      TokenService
-	Users       UserService
-	Permissions PermissionsService
-	Products    ProductService
+	Tokens               TokenService
+	PersonalAccessTokens PersonalAccessTokenService
+	Users                UserService
+	Profiles             ProfileService
+	Identities           IdentityService
+	Permissions          PermissionsService
+	Roles                RoleService
+	Products             ProductService
+	Cart                 CartService
+	Orders               OrderService
+	Invoices             InvoiceService
+	Reviews              ReviewService
+	TwoFactor            TwoFactorService
+	LoginThrottle        LoginThrottleService
+	Sessions             SessionService
+	Audit                AuditService
+	Health               HealthService
 }
 
-func NewServices(db *sql.DB) Services {
+type Config struct {
+	TwoFactor     TwoFactorConfig
+	LoginThrottle LoginThrottleConfig
+	// PermissionsCacheTTL is how long effective permissions are cached in
+	// memory; zero disables the cache.
+	PermissionsCacheTTL time.Duration
+	PasswordPolicy      passwordpolicy.Config
+	PasswordHash        passwordhash.Config
+	// PersonalAccessTokenMaxTTLDays is the longest lifetime a personal access
+	// token may be given; zero means a year.
+	PersonalAccessTokenMaxTTLDays int
+	// QueryTimeout bounds each database operation; zero means three seconds.
+	QueryTimeout time.Duration
+}
+
+func NewServices(db *sql.DB, cfg Config) Services {
+	permissionsCache := NewPermissionsCache(cfg.PermissionsCacheTTL)
+	passwords := passwordpolicy.New(cfg.PasswordPolicy)
+	hasher := passwordhash.New(cfg.PasswordHash)
+
 	return Services{
-		Tokens:      TokenService{DB: db},
-		Users:       UserService{DB: db},
-		Permissions: PermissionsService{DB: db},
-		Products:    ProductService{DB: db},
+		Tokens:               TokenService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		PersonalAccessTokens: PersonalAccessTokenService{DB: db, QueryTimeout: cfg.QueryTimeout, TwoFactor: cfg.TwoFactor, MaxTTLDays: cfg.PersonalAccessTokenMaxTTLDays},
+		Users:                UserService{DB: db, QueryTimeout: cfg.QueryTimeout, Passwords: passwords, Hasher: hasher, PermissionsCache: permissionsCache},
+		Profiles:             ProfileService{DB: db, QueryTimeout: cfg.QueryTimeout, Passwords: passwords, Hasher: hasher},
+		Identities:           IdentityService{DB: db, QueryTimeout: cfg.QueryTimeout, Hasher: hasher, PermissionsCache: permissionsCache},
+		Permissions:          PermissionsService{DB: db, QueryTimeout: cfg.QueryTimeout, Cache: permissionsCache},
+		Roles:                RoleService{DB: db, QueryTimeout: cfg.QueryTimeout, Cache: permissionsCache},
+		Products:             ProductService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		Cart:                 CartService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		Orders:               OrderService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		Invoices:             InvoiceService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		Reviews:              ReviewService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		TwoFactor:            TwoFactorService{DB: db, QueryTimeout: cfg.QueryTimeout, Config: cfg.TwoFactor},
+		LoginThrottle:        LoginThrottleService{DB: db, QueryTimeout: cfg.QueryTimeout, Config: cfg.LoginThrottle},
+		Sessions:             SessionService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		Audit:                AuditService{DB: db, QueryTimeout: cfg.QueryTimeout},
+		Health:               HealthService{DB: db, QueryTimeout: cfg.QueryTimeout},
 	}
 }
 
@@ -29,10 +80,36 @@ type DBConfig struct {
 	MaxOpenConns int
 	MaxIdleConns int
 	MaxIdleTime  time.Duration
+	QueryTimeout time.Duration
+}
+
+const defaultQueryTimeout = 3 * time.Second
+
+// withQueryTimeout bounds a database operation by timeout, or by
+// defaultQueryTimeout for a service built without one. The request's own
+// deadline and cancellation still apply.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
 }
 
+// OpenDB opens a connection pool whose queries are traced as children of the
+// span in their context. Queries made outside a trace, like the session
+// store's cleanup, are left out rather than each starting a trace of its own.
 func OpenDB(cfg DBConfig) (*sql.DB, error) {
-	db, err := sql.Open("postgres", cfg.Dsn)
+	db, err := otelsql.Open("postgres", cfg.Dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+)
+
+// SessionService keeps an index of signed-in sessions per user alongside the
+// scs session store, so users can see their devices and end them.
+type SessionService struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+}
+
+type RegisterSessionReq struct {
+	Token     string
+	UserID    int64
+	IP        string
+	UserAgent string
+}
+
+func (s SessionService) Register(ctx context.Context, req RegisterSessionReq) error {
+	query := `
+        INSERT INTO user_sessions (token, user_id, ip, user_agent)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (token) DO UPDATE
+        SET user_id = EXCLUDED.user_id, ip = EXCLUDED.ip, user_agent = EXCLUDED.user_agent, last_seen_at = NOW()`
+
+	userAgent := req.UserAgent
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	args := []any{req.Token, req.UserID, req.IP, userAgent}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Touch records activity on a session and reports whether the session is in
+// the index at all. Writes are limited to one a minute per session.
+func (s SessionService) Touch(ctx context.Context, token, ip string) (bool, error) {
+	query := `
+        WITH touched AS (
+            UPDATE user_sessions
+            SET last_seen_at = NOW(), ip = $2
+            WHERE token = $1 AND last_seen_at < NOW() - INTERVAL '1 minute'
+        )
+        SELECT EXISTS (SELECT 1 FROM user_sessions WHERE token = $1)`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	var indexed bool
+	err := s.DB.QueryRowContext(ctx, query, token, ip).Scan(&indexed)
+	return indexed, err
+}
+
+func (s SessionService) GetAllForUser(ctx context.Context, userID int64) ([]domain.Session, error) {
+	query := `
+        SELECT user_sessions.id, user_sessions.token, user_sessions.user_id, user_sessions.created_at,
+               user_sessions.last_seen_at, user_sessions.ip, user_sessions.user_agent
+        FROM user_sessions
+        INNER JOIN sessions
+        ON sessions.token = user_sessions.token
+        WHERE user_sessions.user_id = $1 AND sessions.expiry > NOW()
+        ORDER BY user_sessions.last_seen_at DESC`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+
+	for rows.Next() {
+		var session domain.Session
+
+		err := rows.Scan(
+			&session.ID,
+			&session.Token,
+			&session.UserID,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.IP,
+			&session.UserAgent,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke ends one of the user's sessions by deleting it from the scs store.
+func (s SessionService) Revoke(ctx context.Context, userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        DELETE FROM user_sessions
+        WHERE id = $1 AND user_id = $2
+        RETURNING token`
+
+	var token string
+	err = tx.QueryRowContext(ctx, query, id, userID).Scan(&token)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM sessions WHERE token = $1`, token)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeAllForUser ends every session of the user except exceptToken, which
+// may be empty to end them all.
+func (s SessionService) RevokeAllForUser(ctx context.Context, userID int64, exceptToken string) error {
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = revokeSessions(ctx, tx, userID, exceptToken)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeSessions ends the user's sessions other than exceptToken as part of
+// tx.
+func revokeSessions(ctx context.Context, tx *sql.Tx, userID int64, exceptToken string) error {
+	query := `
+        DELETE FROM sessions
+        WHERE token IN (
+            SELECT token FROM user_sessions WHERE user_id = $1 AND token <> $2
+        )`
+
+	_, err := tx.ExecContext(ctx, query, userID, exceptToken)
+	if err != nil {
+		return err
+	}
+
+	query = `
+        DELETE FROM user_sessions
+        WHERE user_id = $1 AND token <> $2`
+
+	_, err = tx.ExecContext(ctx, query, userID, exceptToken)
+	return err
+}
+
+func (s SessionService) Delete(ctx context.Context, token string) error {
+	query := `
+        DELETE FROM user_sessions
+        WHERE token = $1`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query, token)
+	return err
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionTouchReportsUnindexedSessions(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := SessionService{DB: db}
+
+	userID := insertTestUser(t, db, "devices@example.com", "password", true)
+
+	// Both sessions are in the scs store, but only one was signed in after
+	// the index existed.
+	for _, token := range []string{"indexed", "legacy"} {
+		_, err := db.ExecContext(ctx, `INSERT INTO sessions (token, data, expiry) VALUES ($1, '\x00', NOW() + INTERVAL '1 day')`, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.Register(ctx, RegisterSessionReq{Token: "indexed", UserID: userID, IP: "192.0.2.1", UserAgent: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Touch twice: the second falls inside the minute in which writes are
+	// skipped, and must still find the session.
+	for i := 0; i < 2; i++ {
+		indexed, err := s.Touch(ctx, "indexed", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !indexed {
+			t.Errorf("touch %d: indexed session reported missing", i+1)
+		}
+	}
+
+	indexed, err := s.Touch(ctx, "legacy", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed {
+		t.Error("legacy session reported as indexed")
+	}
+}
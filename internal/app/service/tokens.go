@@ -34,39 +34,40 @@ func generateToken(userID int64, ttl time.Duration, scope domain.TokenScope) (*d
 }
 
 type TokenService struct {
-	DB *sql.DB
+	DB           *sql.DB
+	QueryTimeout time.Duration
 }
 
-func (m TokenService) New(userID int64, ttl time.Duration, scope domain.TokenScope) (*domain.Token, error) {
+func (m TokenService) New(ctx context.Context, userID int64, ttl time.Duration, scope domain.TokenScope) (*domain.Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
 	return token, err
 }
 
-func (m TokenService) Insert(token *domain.Token) error {
+func (m TokenService) Insert(ctx context.Context, token *domain.Token) error {
 	query := `
         INSERT INTO tokens (hash, user_id, expiry, scope) 
         VALUES ($1, $2, $3, $4)`
 
 	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, args...)
 	return err
 }
 
-func (m TokenService) DeleteAllForUser(scope domain.TokenScope, userID int64) error {
+func (m TokenService) DeleteAllForUser(ctx context.Context, scope domain.TokenScope, userID int64) error {
 	query := `
         DELETE FROM tokens 
         WHERE scope = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, m.QueryTimeout)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
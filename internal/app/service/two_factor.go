@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/errsx"
+	"github.com/ruhollahh/paperback/pkg/totp"
+)
+
+const recoveryCodeCount = 10
+
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		randomBytes := make([]byte, 7)
+
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)[:10]
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+
+		hash := sha256.Sum256([]byte(codes[i]))
+		hashes[i] = hash[:]
+	}
+
+	return codes, hashes, nil
+}
+
+type TwoFactorConfig struct {
+	Issuer string
+	// RequiredPermissions lists the permission codes whose holders must have
+	// two-factor authentication enabled before using them.
+	RequiredPermissions []string
+}
+
+type TwoFactorService struct {
+	DB           *sql.DB
+	Config       TwoFactorConfig
+	QueryTimeout time.Duration
+}
+
+func (s TwoFactorService) RequiredFor(permissions domain.Permissions) bool {
+	for _, code := range s.Config.RequiredPermissions {
+		if PermissionsInclude(permissions, code) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s TwoFactorService) RequiredForPermission(code string) bool {
+	return PermissionsInclude(s.Config.RequiredPermissions, code)
+}
+
+// Enforce withholds the permissions that require two-factor authentication
+// from a principal who hasn't enabled it, so service.Can treats them as not
+// held.
+func (s TwoFactorService) Enforce(ctx context.Context, p Principal) (Principal, error) {
+	if !s.RequiredFor(p.Permissions) {
+		return p, nil
+	}
+
+	enabled, err := s.Enabled(ctx, p.User.ID)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if enabled {
+		return p, nil
+	}
+
+	return p.Without(s.RequiredForPermission), nil
+}
+
+func (s TwoFactorService) Get(ctx context.Context, userID int64) (*domain.TOTP, error) {
+	query := `
+        SELECT user_id, created_at, secret, confirmed_at, last_used_step
+        FROM users_totp
+        WHERE user_id = $1`
+
+	var t domain.TOTP
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, userID).Scan(
+		&t.UserID,
+		&t.CreatedAt,
+		&t.Secret,
+		&t.ConfirmedAt,
+		&t.LastUsedStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+func (s TwoFactorService) Enabled(ctx context.Context, userID int64) (bool, error) {
+	t, err := s.Get(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return t.Confirmed(), nil
+}
+
+type EnrollTwoFactorRes struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// Enroll starts (or restarts) TOTP enrolment for user. The secret only takes
+// effect once Confirm has verified a code generated from it.
+func (s TwoFactorService) Enroll(ctx context.Context, user *domain.User) (*EnrollTwoFactorRes, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO users_totp (user_id, secret)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret = EXCLUDED.secret, created_at = NOW()
+        WHERE users_totp.confirmed_at IS NULL`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, user.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return &EnrollTwoFactorRes{
+		Secret:          secret,
+		ProvisioningURI: s.ProvisioningURI(user, secret),
+	}, nil
+}
+
+func (s TwoFactorService) ProvisioningURI(user *domain.User, secret string) string {
+	return totp.ProvisioningURI(s.Config.Issuer, user.Email, secret)
+}
+
+// Confirm verifies the first code from a pending enrolment, enables two-factor
+// authentication and returns a fresh set of plaintext recovery codes.
+func (s TwoFactorService) Confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	code, err := domain.NewTOTPCode(code)
+	if err != nil {
+		var errs errsx.Map
+		errs.Set("code", err)
+		return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT secret
+        FROM users_totp
+        WHERE user_id = $1 AND confirmed_at IS NULL
+        FOR UPDATE`
+
+	var secret string
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	step, ok := totp.Validate(code, secret, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	query = `
+        UPDATE users_totp
+        SET confirmed_at = NOW(), last_used_step = $2
+        WHERE user_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks a second-factor code for a user with two-factor enabled. The
+// code may be either a current TOTP code or an unused recovery code; both are
+// single use.
+func (s TwoFactorService) Verify(ctx context.Context, userID int64, code string) error {
+	if totpCode, err := domain.NewTOTPCode(code); err == nil {
+		return s.verifyTOTP(ctx, userID, totpCode)
+	}
+
+	recoveryCode, err := domain.NewRecoveryCode(code)
+	if err != nil {
+		var errs errsx.Map
+		errs.Set("code", "must be a 6 digit code or a recovery code")
+		return fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	return s.useRecoveryCode(ctx, userID, recoveryCode)
+}
+
+func (s TwoFactorService) verifyTOTP(ctx context.Context, userID int64, code string) error {
+	t, err := s.Get(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrInvalidTwoFactorCode
+		default:
+			return err
+		}
+	}
+
+	if !t.Confirmed() {
+		return ErrInvalidTwoFactorCode
+	}
+
+	step, ok := totp.Validate(code, t.Secret, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	query := `
+        UPDATE users_totp
+        SET last_used_step = $2
+        WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// The code was valid but has already been used.
+	if rowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func (s TwoFactorService) useRecoveryCode(ctx context.Context, userID int64, code string) error {
+	hash := sha256.Sum256([]byte(code))
+
+	query := `
+        UPDATE recovery_codes
+        SET used_at = NOW()
+        WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, userID, hash[:])
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func (s TwoFactorService) RemainingRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	query := `
+        SELECT count(*)
+        FROM recovery_codes
+        WHERE user_id = $1 AND used_at IS NULL`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	var count int
+	err := s.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	err := s.Verify(ctx, userID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s TwoFactorService) Disable(ctx context.Context, userID int64, code string) error {
+	err := s.Verify(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO recovery_codes (user_id, hash)
+        VALUES ($1, $2)`
+
+	for _, hash := range hashes {
+		_, err = tx.ExecContext(ctx, query, userID, hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
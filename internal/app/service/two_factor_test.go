@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/totp"
+)
+
+func TestTwoFactorEnforce(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := TwoFactorService{DB: db, Config: TwoFactorConfig{RequiredPermissions: []string{domain.PermissionProductsWrite}}}
+
+	enrolledID := insertTestUser(t, db, "enrolled@example.com", "password", true)
+	pendingID := insertTestUser(t, db, "pending@example.com", "password", true)
+
+	_, err := db.ExecContext(ctx, `INSERT INTO users_totp (user_id, secret, confirmed_at) VALUES ($1, 'JBSWY3DPEHPK3PXP', NOW())`, enrolledID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enrolment that was started but never confirmed doesn't count.
+	_, err = db.ExecContext(ctx, `INSERT INTO users_totp (user_id, secret) VALUES ($1, 'JBSWY3DPEHPK3PXP')`, pendingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permissions := domain.Permissions{domain.PermissionProductsWrite, domain.PermissionOrdersRead}
+
+	enrolled, err := s.Enforce(ctx, Principal{User: &domain.User{ID: enrolledID}, Permissions: permissions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enrolled.Has(domain.PermissionProductsWrite) {
+		t.Error("products:write was withheld from a user with two-factor authentication")
+	}
+
+	pending, err := s.Enforce(ctx, Principal{User: &domain.User{ID: pendingID}, Permissions: permissions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Has(domain.PermissionProductsWrite) {
+		t.Error("products:write was kept for a user without two-factor authentication")
+	}
+	if !pending.Has(domain.PermissionOrdersRead) {
+		t.Error("orders:read was withheld though it doesn't require two-factor authentication")
+	}
+}
+
+func TestTwoFactorVerifyRefusesReplay(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := TwoFactorService{DB: db}
+
+	const secret = "JBSWY3DPEHPK3PXP"
+
+	userID := insertTestUser(t, db, "enrolled@example.com", "password", true)
+
+	_, err := db.ExecContext(ctx, `INSERT INTO users_totp (user_id, secret, confirmed_at) VALUES ($1, $2, NOW())`, userID, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Verify(ctx, userID, code)
+	if err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	err = s.Verify(ctx, userID, code)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("replay: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	// An earlier code, still inside the skew window, is no good either once
+	// a later one has been used.
+	earlier, err := totp.Code(secret, totp.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Verify(ctx, userID, earlier)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("earlier code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+}
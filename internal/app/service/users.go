@@ -2,19 +2,26 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/ruhollahh/paperback/pkg/errsx"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/ruhollahh/paperback/pkg/passwordhash"
+	"github.com/ruhollahh/paperback/pkg/passwordpolicy"
 	"time"
 
 	"github.com/ruhollahh/paperback/internal/app/domain"
 )
 
 type UserService struct {
-	DB *sql.DB
+	DB               *sql.DB
+	Passwords        *passwordpolicy.Policy
+	Hasher           *passwordhash.Hasher
+	PermissionsCache *PermissionsCache
+	QueryTimeout     time.Duration
 }
 
 var AnonymousUser = &domain.User{}
@@ -28,8 +35,8 @@ type password struct {
 	hash      []byte
 }
 
-func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+func (p *password) Set(hasher *passwordhash.Hasher, plaintextPassword string) error {
+	hash, err := hasher.Hash(plaintextPassword)
 	if err != nil {
 		return err
 	}
@@ -40,18 +47,79 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
-func (p *password) Matches(plaintextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+func (p *password) Matches(hasher *passwordhash.Hasher, plaintextPassword string) (bool, error) {
+	return hasher.Verify(p.hash, plaintextPassword)
+}
+
+// validatePassword checks plaintext against the limits every password has and
+// the password policy, recording a problem in errs under key. personal holds
+// the user's own details the password must not be built from.
+func validatePassword(policy *passwordpolicy.Policy, errs *errsx.Map, key, plaintext string, personal ...string) error {
+	_, err := domain.NewPasswordPlaintext(plaintext)
+	if err != nil {
+		errs.Set(key, err)
+		return nil
+	}
+
+	err = policy.Check(plaintext, personal...)
 	if err != nil {
+		var violation passwordpolicy.Violation
 		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
+		case errors.As(err, &violation):
+			errs.Set(key, violation)
 		default:
-			return false, err
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recentLoginWindow is how long after signing in users without a password
+// may take actions that would otherwise ask for it.
+const recentLoginWindow = 10 * time.Minute
+
+// confirmIdentity checks that whoever is asking for a sensitive change is the
+// user: by their password or, for users who don't have one, by a sign-in
+// within recentLoginWindow.
+func confirmIdentity(hasher *passwordhash.Hasher, user *domain.User, plaintextPassword string, authenticatedAt time.Time) error {
+	if !user.HasPassword {
+		if time.Since(authenticatedAt) > recentLoginWindow {
+			return ErrRecentLoginRequired
 		}
+		return nil
+	}
+
+	p := password{hash: user.HashedPassword}
+
+	match, err := p.Matches(hasher, plaintextPassword)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// unusablePasswordHash hashes a random password nobody knows, for accounts
+// that must not be signed in to with a password but still need a hash.
+func unusablePasswordHash(hasher *passwordhash.Hasher) ([]byte, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var p password
+	err = p.Set(hasher, base64.RawStdEncoding.EncodeToString(randomBytes))
+	if err != nil {
+		return nil, err
 	}
 
-	return true, nil
+	return p.hash, nil
 }
 
 type SignupReq struct {
@@ -66,7 +134,7 @@ type SignupRes struct {
 	Version   int32
 }
 
-func (s UserService) Signup(req SignupReq) (*SignupRes, error) {
+func (s UserService) Signup(ctx context.Context, req SignupReq) (*SignupRes, error) {
 	var input struct {
 		name     string
 		email    string
@@ -83,15 +151,15 @@ func (s UserService) Signup(req SignupReq) (*SignupRes, error) {
 	if err != nil {
 		errs.Set("email", err)
 	}
-	plaintextPassword, err := domain.NewEmail(req.Password)
+	err = validatePassword(s.Passwords, &errs, "password", req.Password, req.Name, req.Email)
 	if err != nil {
-		errs.Set("password", err)
+		return nil, err
 	}
 	if errs != nil {
 		return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
 	}
 
-	err = input.password.Set(plaintextPassword)
+	err = input.password.Set(s.Hasher, req.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -103,11 +171,17 @@ func (s UserService) Signup(req SignupReq) (*SignupRes, error) {
 
 	args := []any{input.name, input.email, input.password.hash, false}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	var res SignupRes
-	err = s.DB.QueryRowContext(ctx, query, args...).Scan(&res.ID, &res.CreatedAt, &res.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&res.ID, &res.CreatedAt, &res.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -117,18 +191,28 @@ func (s UserService) Signup(req SignupReq) (*SignupRes, error) {
 		}
 	}
 
+	err = addDefaultRole(ctx, tx, res.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
 	return &res, nil
 }
 
-func (s UserService) GetByID(id int64) (*domain.User, error) {
+func (s UserService) GetByID(ctx context.Context, id int64) (*domain.User, error) {
 	query := `
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, has_password, activated, version
         FROM users
         WHERE id = $1`
 
 	var user domain.User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
 	err := s.DB.QueryRowContext(ctx, query, id).Scan(
@@ -137,6 +221,7 @@ func (s UserService) GetByID(id int64) (*domain.User, error) {
 		&user.Name,
 		&user.Email,
 		&user.HashedPassword,
+		&user.HasPassword,
 		&user.Activated,
 		&user.Version,
 	)
@@ -153,7 +238,7 @@ func (s UserService) GetByID(id int64) (*domain.User, error) {
 	return &user, nil
 }
 
-func (s UserService) GetByEmail(email string) (*domain.User, error) {
+func (s UserService) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	_, err := domain.NewEmail(email)
 	if err != nil {
 		var errs errsx.Map
@@ -162,13 +247,13 @@ func (s UserService) GetByEmail(email string) (*domain.User, error) {
 	}
 
 	query := `
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, has_password, activated, version
         FROM users
         WHERE email = $1`
 
 	var user domain.User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
 	err = s.DB.QueryRowContext(ctx, query, email).Scan(
@@ -177,6 +262,7 @@ func (s UserService) GetByEmail(email string) (*domain.User, error) {
 		&user.Name,
 		&user.Email,
 		&user.HashedPassword,
+		&user.HasPassword,
 		&user.Activated,
 		&user.Version,
 	)
@@ -193,16 +279,92 @@ func (s UserService) GetByEmail(email string) (*domain.User, error) {
 	return &user, nil
 }
 
+type AuthenticateReq struct {
+	Email    string
+	Password string
+}
+
+func (s UserService) Authenticate(ctx context.Context, req AuthenticateReq) (*domain.User, error) {
+	var errs errsx.Map
+
+	if req.Email == "" {
+		errs.Set("email", "must be provided")
+	}
+	if req.Password == "" {
+		errs.Set("password", "must be provided")
+	}
+	if errs != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadRequest, errs)
+	}
+
+	user, err := s.GetByEmail(ctx, req.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound), errors.As(err, &errs):
+			return nil, ErrInvalidCredentials
+		default:
+			return nil, err
+		}
+	}
+
+	p := password{hash: user.HashedPassword}
+
+	match, err := p.Matches(s.Hasher, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// Rehash replaces a just-verified password hash with one made under the
+// current hashing configuration, if it was made under an older one. The
+// update only applies while the old hash is still stored, so it can't undo a
+// password change that raced it, and it leaves version alone because the
+// user changed nothing. The old hash keeps working if this fails, so callers
+// needn't fail the login over it.
+func (s UserService) Rehash(ctx context.Context, user *domain.User, plaintextPassword string) error {
+	if !s.Hasher.NeedsRehash(user.HashedPassword) {
+		return nil
+	}
+
+	var p password
+	err := p.Set(s.Hasher, plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE users
+        SET password_hash = $1
+        WHERE id = $2 AND password_hash = $3`
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	_, err = s.DB.ExecContext(ctx, query, p.hash, user.ID, user.HashedPassword)
+	if err != nil {
+		return err
+	}
+
+	user.HashedPassword = p.hash
+
+	return nil
+}
+
 type ActivateUserReq struct {
-	ID      string
+	ID      int64
 	Version int32
 }
 
-func (s UserService) ActivateUser(req ActivateUserReq) error {
+func (s UserService) ActivateUser(ctx context.Context, req ActivateUserReq) (int32, error) {
 	query := `
-        UPDATE users 
-        SET activated = $1, version = version + 1
-        WHERE id = $2 AND version = $3
+        UPDATE users
+        SET activated = true, version = version + 1
+        WHERE id = $1 AND version = $2
         RETURNING version`
 
 	args := []any{
@@ -210,22 +372,83 @@ func (s UserService) ActivateUser(req ActivateUserReq) error {
 		req.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
-	err := s.DB.QueryRowContext(ctx, query, args...).Scan(&req.Version)
+	var version int32
+	err := s.DB.QueryRowContext(ctx, query, args...).Scan(&version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
+			return 0, ErrEditConflict
 		default:
-			return err
+			return 0, err
 		}
 	}
 
-	return nil
+	return version, nil
+}
+
+type GetAllUsersReq struct {
+	// Query matches users whose name or email contains it.
+	Query   string
+	Filters Filters
+}
+
+func (s UserService) GetAll(ctx context.Context, req GetAllUsersReq) ([]domain.User, Metadata, error) {
+	if err := req.Filters.Validate(nil); err != nil {
+		return nil, Metadata{}, fmt.Errorf("%w: %w", ErrBadRequest, err)
+	}
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, name, email, password_hash, has_password, activated, version
+        FROM users
+        WHERE deleted_at IS NULL
+        AND (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+        ORDER BY %s %s, id ASC
+        LIMIT $2 OFFSET $3`, req.Filters.sortColumn(), req.Filters.sortDirection())
+
+	args := []any{req.Query, req.Filters.limit(), req.Filters.offset()}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var user domain.User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.HashedPassword,
+			&user.HasPassword,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := NewMetadata(totalRecords, req.Filters.Page, req.Filters.PageSize)
+
+	return users, metadata, nil
 }
 
 type GetForTokenReq struct {
@@ -233,11 +456,11 @@ type GetForTokenReq struct {
 	TokenPlaintext string
 }
 
-func (s UserService) GetForToken(req GetForTokenReq) (*domain.User, error) { /**/
+func (s UserService) GetForToken(ctx context.Context, req GetForTokenReq) (*domain.User, error) { /**/
 	tokenHash := sha256.Sum256([]byte(req.TokenPlaintext))
 
 	query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.has_password, users.activated, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -249,7 +472,7 @@ func (s UserService) GetForToken(req GetForTokenReq) (*domain.User, error) { /**
 
 	var user domain.User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
 	defer cancel()
 
 	err := s.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -258,6 +481,7 @@ func (s UserService) GetForToken(req GetForTokenReq) (*domain.User, error) { /**
 		&user.Name,
 		&user.Email,
 		&user.HashedPassword,
+		&user.HasPassword,
 		&user.Activated,
 		&user.Version,
 	)
@@ -272,3 +496,99 @@ func (s UserService) GetForToken(req GetForTokenReq) (*domain.User, error) { /**
 
 	return &user, nil
 }
+
+type DeleteUserReq struct {
+	Actor    domain.AuditActor
+	UserID   int64
+	Password string
+	// AuthenticatedAt is when the user last signed in, which stands in for
+	// the password of users who don't have one.
+	AuthenticatedAt time.Time
+}
+
+// Delete anonymises a user who wants to leave. The row is kept, scrubbed of
+// personal data, so orders and invoices still have an owner for accounting;
+// everything else tied to the user is removed, including their sessions.
+func (s UserService) Delete(ctx context.Context, req DeleteUserReq) error {
+	user, err := s.GetByID(ctx, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = confirmIdentity(s.Hasher, user, req.Password, req.AuthenticatedAt)
+	if err != nil {
+		return err
+	}
+
+	hash, err := unusablePasswordHash(s.Hasher)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, s.QueryTimeout)
+	defer cancel()
+
+	defer s.PermissionsCache.invalidate(user.ID)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM sessions WHERE token IN (SELECT token FROM user_sessions WHERE user_id = $1)`,
+		`DELETE FROM user_sessions WHERE user_id = $1`,
+		`DELETE FROM tokens WHERE user_id = $1`,
+		`DELETE FROM personal_access_tokens WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM users_totp WHERE user_id = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM users_permissions WHERE user_id = $1`,
+		`DELETE FROM users_roles WHERE user_id = $1`,
+		`DELETE FROM reviews WHERE user_id = $1`,
+		`DELETE FROM cart_items WHERE user_id = $1`,
+	}
+
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_failures WHERE kind = $1 AND key = $2`, loginFailureKindAccount, user.Email)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE users
+        SET name = 'Deleted user', email = $2, password_hash = $3, has_password = false, activated = false, deleted_at = NOW(),
+            phone = DEFAULT, language = DEFAULT, notify_orders = DEFAULT, notify_newsletter = DEFAULT,
+            version = version + 1
+        WHERE id = $1 AND version = $4`
+
+	email := fmt.Sprintf("deleted-%d@users.invalid", user.ID)
+
+	result, err := tx.ExecContext(ctx, query, user.ID, email, hash, user.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	err = insertAuditEvent(ctx, tx, newAuditEvent(req.Actor, domain.AuditActionUserDeleted, domain.AuditTargetUser, user.ID))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
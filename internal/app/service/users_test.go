@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ruhollahh/paperback/internal/app/domain"
+	"github.com/ruhollahh/paperback/pkg/passwordpolicy"
+)
+
+func TestUserDeleteAnonymises(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	s := UserService{DB: db, Hasher: testHasher}
+
+	userID := insertTestUser(t, db, "leaving@example.com", "password", true)
+
+	setup := []string{
+		`UPDATE users SET phone = '+989120000000', language = 'en', notify_orders = false, notify_newsletter = true WHERE id = $1`,
+		`INSERT INTO products (title, description, price) VALUES ('Book', '', 100)`,
+		`INSERT INTO cart_items (user_id, product_id, quantity) SELECT $1, id, 2 FROM products`,
+	}
+	for _, statement := range setup {
+		var args []any
+		if strings.Contains(statement, "$1") {
+			args = append(args, userID)
+		}
+
+		_, err := db.ExecContext(ctx, statement, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+
+	err := s.Delete(ctx, DeleteUserReq{Actor: domain.AuditActor{UserID: userID}, UserID: userID, Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := ProfileService{DB: db}.Get(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := domain.Profile{
+		UserID:           userID,
+		Name:             "Deleted user",
+		Email:            fmt.Sprintf("deleted-%d@users.invalid", userID),
+		Phone:            "",
+		Language:         "fa",
+		NotifyOrders:     true,
+		NotifyNewsletter: false,
+		Version:          profile.Version,
+	}
+	if *profile != want {
+		t.Errorf("profile after deletion = %+v, want %+v", *profile, want)
+	}
+
+	if n := countRows(t, db, `SELECT COUNT(*) FROM cart_items WHERE user_id = $1`, userID); n != 0 {
+		t.Errorf("cart items = %d after deletion, want none", n)
+	}
+
+	if n := countRows(t, db, `SELECT COUNT(*) FROM users WHERE id = $1 AND NOT has_password`, userID); n != 1 {
+		t.Error("deleted user still has a usable password")
+	}
+}
+
+func TestUserDeleteConfirmsIdentity(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		hasPassword     bool
+		password        string
+		authenticatedAt time.Time
+		wantErr         error
+	}{
+		{"correct password", true, "password", time.Time{}, nil},
+		{"wrong password", true, "wrong-password", time.Now(), ErrInvalidCredentials},
+		// A recent sign-in doesn't stand in for a password the user has.
+		{"recent sign-in without the password", true, "", time.Now(), ErrInvalidCredentials},
+		{"no password, recent sign-in", false, "", time.Now().Add(-time.Minute), nil},
+		{"no password, old sign-in", false, "", time.Now().Add(-recentLoginWindow - time.Minute), ErrRecentLoginRequired},
+		{"no password, never signed in", false, "", time.Time{}, ErrRecentLoginRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			s := UserService{DB: db, Hasher: testHasher}
+
+			userID := insertTestUser(t, db, "leaving@example.com", "password", true)
+
+			_, err := db.ExecContext(ctx, `UPDATE users SET has_password = $2 WHERE id = $1`, userID, tt.hasPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.Delete(ctx, DeleteUserReq{
+				Actor:           domain.AuditActor{UserID: userID},
+				UserID:          userID,
+				Password:        tt.password,
+				AuthenticatedAt: tt.authenticatedAt,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			deleted := countRows(t, db, `SELECT COUNT(*) FROM users WHERE id = $1 AND deleted_at IS NOT NULL`, userID) == 1
+			if deleted != (tt.wantErr == nil) {
+				t.Errorf("deleted = %t, want %t", deleted, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestUserDeleteInvalidatesPermissions(t *testing.T) {
+	ctx := context.Background()
+
+	db := newTestDB(t)
+	cache := NewPermissionsCache(time.Hour)
+	s := UserService{DB: db, Hasher: testHasher, PermissionsCache: cache}
+	permissions := PermissionsService{DB: db, Cache: cache}
+
+	userID := insertTestUser(t, db, "leaving@example.com", "password", true)
+
+	err := permissions.AddForUser(ctx, userID, domain.PermissionOrdersRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	granted, err := permissions.GetAllForUser(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !PermissionsInclude(granted, domain.PermissionOrdersRead) {
+		t.Fatal("orders:read was not granted")
+	}
+
+	err = s.Delete(ctx, DeleteUserReq{Actor: domain.AuditActor{UserID: userID}, UserID: userID, Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	granted, err = permissions.GetAllForUser(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(granted) != 0 {
+		t.Errorf("permissions after deletion = %v, want none", granted)
+	}
+}
+
+func TestChangePasswordWithoutPassword(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		authenticatedAt time.Time
+		wantErr         error
+	}{
+		{"recent sign-in sets the first password", time.Now(), nil},
+		{"old sign-in must sign in again", time.Now().Add(-recentLoginWindow - time.Minute), ErrRecentLoginRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			s := ProfileService{DB: db, Hasher: testHasher, Passwords: passwordpolicy.New(passwordpolicy.Config{MinLength: 8})}
+
+			userID := insertTestUser(t, db, "oidc@example.com", "unknown-to-anyone", true)
+
+			var version int32
+			err := db.QueryRowContext(ctx, `UPDATE users SET has_password = false WHERE id = $1 RETURNING version`, userID).Scan(&version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.ChangePassword(ctx, ChangePasswordReq{
+				Actor:           domain.AuditActor{UserID: userID},
+				UserID:          userID,
+				NewPassword:     "a brand new passphrase",
+				Version:         version,
+				AuthenticatedAt: tt.authenticatedAt,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			user, err := UserService{DB: db}.GetByID(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !user.HasPassword {
+				t.Error("user has no password after setting one")
+			}
+
+			_, err = UserService{DB: db, Hasher: testHasher}.Authenticate(ctx, AuthenticateReq{Email: "oidc@example.com", Password: "a brand new passphrase"})
+			if err != nil {
+				t.Errorf("signing in with the new password: %v", err)
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"html/template"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/go-mail/mail/v2"
@@ -27,6 +30,18 @@ func NewMailer(host string, port int, username, password, sender string) Mailer
 	}
 }
 
+// Ping checks that the SMTP server accepts connections, without logging in.
+func (m Mailer) Ping(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(m.dialer.Host, strconv.Itoa(m.dialer.Port)))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
 func (m Mailer) Send(recipient, templateFile string, data any) error {
 	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
 	if err != nil {
@@ -67,5 +82,5 @@ func (m Mailer) Send(recipient, templateFile string, data any) error {
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	return nil
+	return err
 }
@@ -0,0 +1,383 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "paperback"
+	testKeyID    = "key-1"
+)
+
+// testProvider is an in-process stand-in for an OpenID provider. It serves
+// discovery, a key set and a token endpoint that checks PKCE before handing
+// out whatever ID token the test asked for.
+type testProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu         sync.Mutex
+	challenges map[string]string
+	idToken    string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &testProvider{
+		t:          t,
+		key:        key,
+		challenges: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", tp.discovery)
+	mux.HandleFunc("/jwks", tp.jwks)
+	mux.HandleFunc("/token", tp.token)
+
+	tp.server = httptest.NewServer(mux)
+	t.Cleanup(tp.server.Close)
+
+	return tp
+}
+
+func (tp *testProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 tp.server.URL,
+		"authorization_endpoint": tp.server.URL + "/authorize",
+		"token_endpoint":         tp.server.URL + "/token",
+		"jwks_uri":               tp.server.URL + "/jwks",
+	})
+}
+
+func (tp *testProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(tp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(tp.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (tp *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tp.mu.Lock()
+	challenge, ok := tp.challenges[r.PostForm.Get("code")]
+	delete(tp.challenges, r.PostForm.Get("code"))
+	idToken := tp.idToken
+	tp.mu.Unlock()
+
+	if !ok || codeChallenge(r.PostForm.Get("code_verifier")) != challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+}
+
+// authorize plays the user approving the login: it reads the PKCE challenge
+// from the authorization URL the provider built and issues a code for it.
+func (tp *testProvider) authorize(p *Provider, req *AuthRequest) string {
+	tp.t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		tp.t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		tp.t.Fatal(err)
+	}
+
+	if method := u.Query().Get("code_challenge_method"); method != "S256" {
+		tp.t.Fatalf("code_challenge_method = %q, want S256", method)
+	}
+
+	code := "code-" + req.State
+
+	tp.mu.Lock()
+	tp.challenges[code] = u.Query().Get("code_challenge")
+	tp.mu.Unlock()
+
+	return code
+}
+
+func (tp *testProvider) setIDToken(idToken string) {
+	tp.mu.Lock()
+	tp.idToken = idToken
+	tp.mu.Unlock()
+}
+
+func (tp *testProvider) claims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":            tp.server.URL,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": testKeyID, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestExchange(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// modify adjusts the ID token's claims, or the key it is signed with.
+		modify func(tp *testProvider, claims map[string]any) *rsa.PrivateKey
+		// tamper adjusts the login's secrets after the code was issued.
+		tamper func(req *AuthRequest)
+		// wantErr is part of the error expected, or "" for success.
+		wantErr string
+	}{
+		{
+			name: "valid token",
+		},
+		{
+			name: "audience list containing the client",
+			modify: func(tp *testProvider, claims map[string]any) *rsa.PrivateKey {
+				claims["aud"] = []string{"someone-else", testClientID}
+				return tp.key
+			},
+		},
+		{
+			name: "bad signature",
+			modify: func(tp *testProvider, claims map[string]any) *rsa.PrivateKey {
+				return otherKey
+			},
+			wantErr: "verification error",
+		},
+		{
+			name: "wrong issuer",
+			modify: func(tp *testProvider, claims map[string]any) *rsa.PrivateKey {
+				claims["iss"] = "https://evil.example.com"
+				return tp.key
+			},
+			wantErr: "unexpected issuer",
+		},
+		{
+			name: "wrong audience",
+			modify: func(tp *testProvider, claims map[string]any) *rsa.PrivateKey {
+				claims["aud"] = "someone-else"
+				return tp.key
+			},
+			wantErr: "unexpected audience",
+		},
+		{
+			name: "expired",
+			modify: func(tp *testProvider, claims map[string]any) *rsa.PrivateKey {
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return tp.key
+			},
+			wantErr: "token expired",
+		},
+		{
+			name: "nonce mismatch",
+			modify: func(tp *testProvider, claims map[string]any) *rsa.PrivateKey {
+				claims["nonce"] = "another-login"
+				return tp.key
+			},
+			wantErr: "nonce mismatch",
+		},
+		{
+			name: "missing subject",
+			modify: func(tp *testProvider, claims map[string]any) *rsa.PrivateKey {
+				delete(claims, "sub")
+				return tp.key
+			},
+			wantErr: "missing subject",
+		},
+		{
+			name: "PKCE verifier mismatch",
+			tamper: func(req *AuthRequest) {
+				req.CodeVerifier = "not-the-verifier-the-challenge-was-made-from"
+			},
+			wantErr: "invalid_grant",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestProvider(t)
+
+			provider := NewProvider(ProviderConfig{
+				Name:        "test",
+				Issuer:      tp.server.URL,
+				ClientID:    testClientID,
+				RedirectURL: "https://paperback.example.com/user/login/oidc/test/callback",
+				Scopes:      []string{"openid", "email"},
+			}, tp.server.Client())
+
+			req, err := NewAuthRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code := tp.authorize(provider, req)
+
+			claims := tp.claims(req.Nonce)
+			key := tp.key
+			if tt.modify != nil {
+				key = tt.modify(tp, claims)
+			}
+			tp.setIDToken(signIDToken(t, key, claims))
+
+			if tt.tamper != nil {
+				tt.tamper(req)
+			}
+
+			got, err := provider.Exchange(context.Background(), code, req)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("Exchange succeeded with claims %+v, want an error", got)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			want := Claims{Subject: "subject-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+			if *got != want {
+				t.Errorf("claims = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsUnsignedToken(t *testing.T) {
+	tp := newTestProvider(t)
+
+	provider := NewProvider(ProviderConfig{
+		Name:        "test",
+		Issuer:      tp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://paperback.example.com/callback",
+	}, tp.server.Client())
+
+	req, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := tp.authorize(provider, req)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload, err := json.Marshal(tp.claims(req.Nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp.setIDToken(header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".")
+
+	_, err = provider.Exchange(context.Background(), code, req)
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	tp := newTestProvider(t)
+
+	provider := NewProvider(ProviderConfig{
+		Name:        "test",
+		Issuer:      tp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://paperback.example.com/callback",
+		Scopes:      []string{"openid", "email"},
+	}, tp.server.Client())
+
+	req := &AuthRequest{State: "state", Nonce: "nonce", CodeVerifier: "verifier"}
+
+	authURL, err := provider.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(authURL, tp.server.URL+"/authorize?") {
+		t.Fatalf("url = %q, want the discovered authorization endpoint", authURL)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://paperback.example.com/callback",
+		"scope":                 "openid email",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        codeChallenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package testdb gives tests that need PostgreSQL a database of their own.
+package testdb
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"io/fs"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/ruhollahh/paperback/migrations"
+)
+
+// New returns a connection to a fresh, fully migrated schema in the
+// database named by PAPERBACK_TEST_DB_DSN, skipping the test when it isn't
+// set. The schema is dropped when the test ends. The database needs the
+// citext extension installed in its public schema.
+func New(t testing.TB) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("PAPERBACK_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("PAPERBACK_TEST_DB_DSN is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(suffix)
+
+	_, err = admin.Exec(`CREATE SCHEMA ` + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		if err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+
+	// lib/pq passes unknown options on as run-time parameters, so every
+	// connection in the pool starts out in the test schema.
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema+",public")
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema + ",public"
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	names, err := fs.Glob(migrations.Files, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		migration, err := fs.ReadFile(migrations.Files, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = db.Exec(string(migration))
+		if err != nil {
+			t.Fatalf("applying %s: %v", name, err)
+		}
+	}
+
+	return db
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS personal_access_tokens
+(
+    id           bigserial PRIMARY KEY,
+    created_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id      bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    name         text                        NOT NULL,
+    prefix       text                        NOT NULL,
+    hash         bytea UNIQUE                NOT NULL,
+    permissions  text[]                      NOT NULL,
+    expiry       timestamp(0) with time zone,
+    last_used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    id         bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id    bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    provider   text                        NOT NULL,
+    subject    text                        NOT NULL,
+    email      citext                      NOT NULL,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
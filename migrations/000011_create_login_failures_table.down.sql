@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'users:write';
+DROP TABLE IF EXISTS login_failures;
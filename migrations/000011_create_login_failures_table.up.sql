@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    kind           text                        NOT NULL,
+    key            citext                      NOT NULL,
+    failures       integer                     NOT NULL DEFAULT 0,
+    last_failed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until   timestamp(0) with time zone,
+    PRIMARY KEY (kind, key)
+);
+
+INSERT INTO permissions (code)
+VALUES ('users:write');
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_sessions
+(
+    id           bigserial PRIMARY KEY,
+    token        text UNIQUE                 NOT NULL,
+    user_id      bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_seen_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ip           text                        NOT NULL,
+    user_agent   text                        NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions (user_id);
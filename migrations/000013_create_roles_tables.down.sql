@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles_permissions;
+DROP TABLE IF EXISTS roles;
+
+DELETE FROM permissions
+WHERE code IN ('orders:read', 'orders:write', 'invoices:read', 'invoices:write', 'users:read', 'reviews:write', 'reviews:moderate');
+
+ALTER TABLE permissions
+    DROP CONSTRAINT IF EXISTS permissions_code_key;
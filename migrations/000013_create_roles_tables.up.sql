@@ -0,0 +1,56 @@
+ALTER TABLE permissions
+    ADD CONSTRAINT permissions_code_key UNIQUE (code);
+
+CREATE TABLE IF NOT EXISTS roles
+(
+    id   bigserial PRIMARY KEY,
+    name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions
+(
+    role_id       bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles
+(
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+-- Complete the permission catalogue.
+INSERT INTO permissions (code)
+VALUES ('orders:read'),
+       ('orders:write'),
+       ('invoices:read'),
+       ('invoices:write'),
+       ('users:read'),
+       ('reviews:write'),
+       ('reviews:moderate')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles (name)
+VALUES ('customer'),
+       ('editor'),
+       ('fulfilment'),
+       ('accountant'),
+       ('admin');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    (roles.name = 'customer' AND permissions.code IN ('reviews:write')) OR
+    (roles.name = 'editor' AND permissions.code IN ('products:write', 'reviews:moderate')) OR
+    (roles.name = 'fulfilment' AND permissions.code IN ('orders:read', 'orders:write')) OR
+    (roles.name = 'accountant' AND permissions.code IN ('orders:read', 'invoices:read', 'invoices:write')) OR
+    (roles.name = 'admin');
+
+-- Existing users are customers.
+INSERT INTO users_roles
+SELECT users.id, roles.id
+FROM users
+INNER JOIN roles ON roles.name = 'customer';
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'permissions:manage';
+DROP TABLE IF EXISTS audit_events;
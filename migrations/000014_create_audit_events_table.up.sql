@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    actor_id    bigint                      REFERENCES users ON DELETE SET NULL,
+    action      text                        NOT NULL,
+    target_type text                        NOT NULL,
+    target_id   text                        NOT NULL,
+    details     jsonb                       NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+
+INSERT INTO permissions (code)
+VALUES ('permissions:manage');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON permissions.code = 'permissions:manage'
+WHERE roles.name = 'admin';
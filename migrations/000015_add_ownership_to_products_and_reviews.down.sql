@@ -0,0 +1,4 @@
+DELETE FROM roles WHERE name = 'publisher';
+DELETE FROM permissions WHERE code = 'products:publish';
+DROP TABLE IF EXISTS reviews;
+ALTER TABLE products DROP COLUMN IF EXISTS publisher_id;
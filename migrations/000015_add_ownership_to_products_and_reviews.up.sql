@@ -0,0 +1,36 @@
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS publisher_id bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_products_publisher_id ON products (publisher_id);
+
+CREATE TABLE IF NOT EXISTS reviews
+(
+    id         bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    product_id bigint                      NOT NULL REFERENCES products ON DELETE CASCADE,
+    user_id    bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    rating     smallint                    NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    body       text                        NOT NULL DEFAULT '',
+    version    integer                     NOT NULL DEFAULT 1,
+    UNIQUE (product_id, user_id)
+);
+
+-- Publishers manage their own products only; products:write still covers the
+-- whole catalogue.
+INSERT INTO permissions (code)
+VALUES ('products:publish');
+
+INSERT INTO roles (name)
+VALUES ('publisher');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON permissions.code IN ('products:publish', 'reviews:write')
+WHERE roles.name = 'publisher';
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON permissions.code = 'products:publish'
+WHERE roles.name = 'admin';
@@ -0,0 +1,10 @@
+DELETE FROM permissions WHERE code = 'audit:read';
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+DROP INDEX IF EXISTS idx_audit_events_created_at;
+DROP INDEX IF EXISTS idx_audit_events_action;
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS after,
+    DROP COLUMN IF EXISTS before;
@@ -0,0 +1,40 @@
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS before     jsonb NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS after      jsonb NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS ip         text  NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS user_agent text  NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- The log is append-only. The one change allowed is clearing actor_id, which
+-- happens when the acting user is deleted.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.actor_id IS NULL AND
+       (NEW.id, NEW.created_at, NEW.action, NEW.target_type, NEW.target_id, NEW.details, NEW.before, NEW.after,
+        NEW.ip, NEW.user_agent) IS NOT DISTINCT FROM
+       (OLD.id, OLD.created_at, OLD.action, OLD.target_type, OLD.target_id, OLD.details, OLD.before, OLD.after,
+        OLD.ip, OLD.user_agent) THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_events
+    FOR EACH ROW
+EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (code)
+VALUES ('audit:read');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON permissions.code = 'audit:read'
+WHERE roles.name = 'admin';
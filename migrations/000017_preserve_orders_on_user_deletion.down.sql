@@ -0,0 +1,10 @@
+ALTER TABLE invoices
+    DROP CONSTRAINT IF EXISTS invoices_order_id_fkey,
+    ADD CONSTRAINT invoices_order_id_fkey FOREIGN KEY (order_id) REFERENCES orders ON DELETE CASCADE;
+
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_user_id_fkey,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users ON DELETE CASCADE;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,13 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+-- Orders and invoices are kept for accounting; users who leave are
+-- anonymised instead of deleted, and a stray DELETE must not take the
+-- history with it.
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_user_id_fkey,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users ON DELETE RESTRICT;
+
+ALTER TABLE invoices
+    DROP CONSTRAINT IF EXISTS invoices_order_id_fkey,
+    ADD CONSTRAINT invoices_order_id_fkey FOREIGN KEY (order_id) REFERENCES orders ON DELETE RESTRICT;
@@ -0,0 +1,8 @@
+INSERT INTO permissions (code)
+VALUES ('users:impersonate');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON permissions.code = 'users:impersonate'
+WHERE roles.name = 'admin';
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS notify_newsletter,
+    DROP COLUMN IF EXISTS notify_orders,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS phone;
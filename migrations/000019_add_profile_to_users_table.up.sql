@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS phone             text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS language          text NOT NULL DEFAULT 'fa',
+    ADD COLUMN IF NOT EXISTS notify_orders     bool NOT NULL DEFAULT true,
+    ADD COLUMN IF NOT EXISTS notify_newsletter bool NOT NULL DEFAULT false;
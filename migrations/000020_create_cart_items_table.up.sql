@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS cart_items
+(
+    user_id    bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    product_id bigint                      NOT NULL REFERENCES products ON DELETE CASCADE,
+    quantity   integer                     NOT NULL CHECK (quantity > 0),
+    added_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, product_id)
+);
@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS has_password bool NOT NULL DEFAULT true;
+
+-- Users created from an external identity were given a password nobody
+-- knows, in the same transaction, and so at the same moment, as their first
+-- identity. Deleted users were given one too.
+UPDATE users
+SET has_password = false
+WHERE deleted_at IS NOT NULL
+   OR EXISTS (
+       SELECT 1
+       FROM user_identities
+       WHERE user_identities.user_id = users.id AND user_identities.created_at = users.created_at
+   );
@@ -0,0 +1,5 @@
+-- Order lines are part of the order history; a product that has been ordered
+-- can't be deleted out from under them.
+ALTER TABLE order_items
+    DROP CONSTRAINT IF EXISTS order_items_product_id_fkey,
+    ADD CONSTRAINT order_items_product_id_fkey FOREIGN KEY (product_id) REFERENCES products ON DELETE RESTRICT;
@@ -0,0 +1,36 @@
+// Package migrations embeds the schema migrations so the server knows which
+// version of the schema it was built for.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var Files embed.FS
+
+// Latest returns the version of the newest up migration.
+func Latest() (uint, error) {
+	names, err := fs.Glob(Files, "*.up.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migrations: bad file name %q", name)
+		}
+
+		latest = max(latest, uint(version))
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,281 @@
+// Package passwordhash hashes passwords with a configurable algorithm. Every
+// hash carries its algorithm and parameters, so hashes made under an older
+// configuration still verify and can be spotted for rehashing.
+//
+// bcrypt hashes use bcrypt's own modular crypt format ($2a$12$...); argon2id
+// hashes use the PHC string format ($argon2id$v=19$m=65536,t=3,p=2$salt$key).
+package passwordhash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("passwordhash: unknown hash algorithm")
+	ErrInvalidParameter = errors.New("passwordhash: invalid parameter")
+)
+
+// ParseAlgorithm checks that name is a supported algorithm.
+func ParseAlgorithm(name string) (string, error) {
+	switch name {
+	case AlgorithmBcrypt, AlgorithmArgon2id:
+		return name, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownAlgorithm, name)
+	}
+}
+
+// ParseBcryptCost parses a bcrypt cost. bcrypt quietly hashes with its
+// default cost when given one out of range, which would leave every hash
+// looking due for a rehash, so such costs are refused here instead.
+func ParseBcryptCost(val string) (int, error) {
+	cost, err := parseUint(val, "bcrypt cost", uint64(bcrypt.MinCost), uint64(bcrypt.MaxCost))
+	return int(cost), err
+}
+
+// ParseArgon2Memory parses an argon2id memory size in KiB.
+func ParseArgon2Memory(val string) (uint32, error) {
+	memory, err := parseUint(val, "argon2id memory", 1, math.MaxUint32)
+	return uint32(memory), err
+}
+
+// ParseArgon2Time parses an argon2id iteration count.
+func ParseArgon2Time(val string) (uint32, error) {
+	iterations, err := parseUint(val, "argon2id time", 1, math.MaxUint32)
+	return uint32(iterations), err
+}
+
+// ParseArgon2Threads parses an argon2id parallelism, which the hash format
+// stores in a single byte.
+func ParseArgon2Threads(val string) (uint8, error) {
+	threads, err := parseUint(val, "argon2id threads", 1, math.MaxUint8)
+	return uint8(threads), err
+}
+
+func parseUint(val, name string, min, max uint64) (uint64, error) {
+	n, err := strconv.ParseUint(val, 10, 64)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%w: %s must be between %d and %d", ErrInvalidParameter, name, min, max)
+	}
+
+	return n, nil
+}
+
+type Argon2Config struct {
+	// Memory is in KiB.
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+type Config struct {
+	// Algorithm is used for new hashes; hashes made with any supported
+	// algorithm still verify.
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Config
+}
+
+type Hasher struct {
+	config Config
+}
+
+// New returns a Hasher for cfg, filling zero values with defaults.
+func New(cfg Config) *Hasher {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgorithmBcrypt
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = 12
+	}
+	if cfg.Argon2.Memory == 0 {
+		cfg.Argon2.Memory = 64 * 1024
+	}
+	if cfg.Argon2.Time == 0 {
+		cfg.Argon2.Time = 3
+	}
+	if cfg.Argon2.Threads == 0 {
+		cfg.Argon2.Threads = 2
+	}
+	if cfg.Argon2.SaltLen == 0 {
+		cfg.Argon2.SaltLen = 16
+	}
+	if cfg.Argon2.KeyLen == 0 {
+		cfg.Argon2.KeyLen = 32
+	}
+
+	return &Hasher{config: cfg}
+}
+
+// Hash hashes plaintext with the configured algorithm.
+func (h *Hasher) Hash(plaintext string) ([]byte, error) {
+	switch h.config.Algorithm {
+	case AlgorithmBcrypt:
+		return bcrypt.GenerateFromPassword([]byte(plaintext), h.config.BcryptCost)
+	case AlgorithmArgon2id:
+		salt := make([]byte, h.config.Argon2.SaltLen)
+
+		_, err := rand.Read(salt)
+		if err != nil {
+			return nil, err
+		}
+
+		params := argon2Params{
+			memory:  h.config.Argon2.Memory,
+			time:    h.config.Argon2.Time,
+			threads: h.config.Argon2.Threads,
+		}
+
+		key := argon2.IDKey([]byte(plaintext), salt, params.time, params.memory, params.threads, h.config.Argon2.KeyLen)
+
+		return params.encode(salt, key), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, h.config.Algorithm)
+	}
+}
+
+// Verify reports whether plaintext matches hash, whatever algorithm hash was
+// made with.
+func (h *Hasher) Verify(hash []byte, plaintext string) (bool, error) {
+	switch {
+	case isBcrypt(hash):
+		err := bcrypt.CompareHashAndPassword(hash, []byte(plaintext))
+		if err != nil {
+			switch {
+			case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+				return false, nil
+			default:
+				return false, err
+			}
+		}
+
+		return true, nil
+	case isArgon2id(hash):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(plaintext), salt, params.time, params.memory, params.threads, uint32(len(key)))
+
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	default:
+		return false, ErrUnknownAlgorithm
+	}
+}
+
+// NeedsRehash reports whether hash was made with a different algorithm or
+// different parameters than the ones currently configured. It should only be
+// asked of a hash that has just been verified.
+func (h *Hasher) NeedsRehash(hash []byte) bool {
+	switch h.config.Algorithm {
+	case AlgorithmBcrypt:
+		if !isBcrypt(hash) {
+			return true
+		}
+
+		cost, err := bcrypt.Cost(hash)
+		return err != nil || cost != h.config.BcryptCost
+	case AlgorithmArgon2id:
+		if !isArgon2id(hash) {
+			return true
+		}
+
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return true
+		}
+
+		return params.memory != h.config.Argon2.Memory ||
+			params.time != h.config.Argon2.Time ||
+			params.threads != h.config.Argon2.Threads ||
+			uint32(len(salt)) != h.config.Argon2.SaltLen ||
+			uint32(len(key)) != h.config.Argon2.KeyLen
+	default:
+		return false
+	}
+}
+
+func isBcrypt(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) ||
+		bytes.HasPrefix(hash, []byte("$2b$")) ||
+		bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+func isArgon2id(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$"+AlgorithmArgon2id+"$"))
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func (p argon2Params) encode(salt, key []byte) []byte {
+	return []byte(fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id,
+		argon2.Version,
+		p.memory,
+		p.time,
+		p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	))
+}
+
+var errMalformedArgon2id = errors.New("passwordhash: malformed argon2id hash")
+
+func decodeArgon2id(hash []byte) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errMalformedArgon2id
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return params, nil, nil, errMalformedArgon2id
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("passwordhash: unsupported argon2 version %d", version)
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return params, nil, nil, errMalformedArgon2id
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errMalformedArgon2id
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errMalformedArgon2id
+	}
+
+	return params, salt, key, nil
+}
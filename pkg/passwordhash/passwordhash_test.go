@@ -0,0 +1,105 @@
+package passwordhash
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func(string) error
+		val     string
+		wantErr bool
+	}{
+		{"bcrypt cost in range", parseBcryptCost, "12", false},
+		{"bcrypt minimum cost", parseBcryptCost, "4", false},
+		{"bcrypt maximum cost", parseBcryptCost, "31", false},
+		{"bcrypt cost too low", parseBcryptCost, "3", true},
+		{"bcrypt cost too high", parseBcryptCost, "32", true},
+		{"bcrypt cost negative", parseBcryptCost, "-1", true},
+		{"bcrypt cost not a number", parseBcryptCost, "high", true},
+		{"argon2 threads in range", parseArgon2Threads, "255", false},
+		{"argon2 threads overflowing a byte", parseArgon2Threads, "256", true},
+		{"argon2 zero threads", parseArgon2Threads, "0", true},
+		{"argon2 zero time", parseArgon2Time, "0", true},
+		{"argon2 time in range", parseArgon2Time, "3", false},
+		{"argon2 memory overflowing uint32", parseArgon2Memory, "4294967296", true},
+		{"argon2 memory in range", parseArgon2Memory, "65536", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.parse(tt.val)
+			if tt.wantErr && !errors.Is(err, ErrInvalidParameter) {
+				t.Errorf("err = %v, want ErrInvalidParameter", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("err = %v, want none", err)
+			}
+		})
+	}
+}
+
+func parseBcryptCost(val string) error {
+	_, err := ParseBcryptCost(val)
+	return err
+}
+
+func parseArgon2Memory(val string) error {
+	_, err := ParseArgon2Memory(val)
+	return err
+}
+
+func parseArgon2Time(val string) error {
+	_, err := ParseArgon2Time(val)
+	return err
+}
+
+func parseArgon2Threads(val string) error {
+	_, err := ParseArgon2Threads(val)
+	return err
+}
+
+func TestNeedsRehash(t *testing.T) {
+	cheapBcrypt := New(Config{Algorithm: AlgorithmBcrypt, BcryptCost: 4})
+	otherBcrypt := New(Config{Algorithm: AlgorithmBcrypt, BcryptCost: 5})
+	cheapArgon2 := New(Config{Algorithm: AlgorithmArgon2id, Argon2: Argon2Config{Memory: 64, Time: 1, Threads: 1}})
+
+	hash, err := cheapBcrypt.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cheapBcrypt.NeedsRehash(hash) {
+		t.Error("hash made under the current configuration needs a rehash")
+	}
+	if !otherBcrypt.NeedsRehash(hash) {
+		t.Error("hash made with another bcrypt cost doesn't need a rehash")
+	}
+	if !cheapArgon2.NeedsRehash(hash) {
+		t.Error("bcrypt hash doesn't need a rehash under argon2id")
+	}
+
+	// Hashes made under any configuration still verify.
+	for _, hasher := range []*Hasher{cheapBcrypt, otherBcrypt, cheapArgon2} {
+		match, err := hasher.Verify(hash, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !match {
+			t.Error("hash made under an older configuration no longer verifies")
+		}
+	}
+
+	argon2Hash, err := cheapArgon2.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cheapArgon2.NeedsRehash(argon2Hash) {
+		t.Error("argon2id hash made under the current configuration needs a rehash")
+	}
+	if !cheapBcrypt.NeedsRehash(argon2Hash) {
+		t.Error("argon2id hash doesn't need a rehash under bcrypt")
+	}
+}
@@ -0,0 +1,149 @@
+// Package passwordpolicy decides whether a password is acceptable: long
+// enough, not a well-known password, not made from the user's own details and,
+// optionally, not found in a local dataset of breached passwords.
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common.txt
+var commonPasswords string
+
+const defaultMinLength = 8
+
+type Config struct {
+	MinLength int
+	// BreachedDir, when set, is a directory of breached-password hash
+	// prefixes in the layout of the Pwned Passwords range API: one file per
+	// 5 character SHA-1 prefix, named PREFIX.txt, holding SUFFIX:COUNT
+	// lines. Only the file for the password's prefix is ever read.
+	BreachedDir string
+}
+
+// Violation is returned by Check when a password breaks the policy. Its
+// message is meant for the user.
+type Violation struct {
+	msg string
+}
+
+func (v Violation) Error() string {
+	return v.msg
+}
+
+type Policy struct {
+	config Config
+	banned map[string]struct{}
+}
+
+func New(cfg Config) *Policy {
+	if cfg.MinLength < 1 {
+		cfg.MinLength = defaultMinLength
+	}
+
+	banned := make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswords, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		banned[strings.ToLower(line)] = struct{}{}
+	}
+
+	return &Policy{config: cfg, banned: banned}
+}
+
+// Check returns a Violation if password is unacceptable. personal holds the
+// user's own details, such as their name and email address, which the
+// password must not be built from. Any other error means the check itself
+// failed.
+func (p *Policy) Check(password string, personal ...string) error {
+	if utf8.RuneCountInString(password) < p.config.MinLength {
+		return Violation{fmt.Sprintf("must be at least %d characters long", p.config.MinLength)}
+	}
+
+	lower := strings.ToLower(password)
+
+	if _, ok := p.banned[lower]; ok {
+		return Violation{"is too common, choose a less predictable password"}
+	}
+
+	for _, detail := range personal {
+		for _, word := range personalWords(detail) {
+			if strings.Contains(lower, word) {
+				return Violation{"must not contain your name or email address"}
+			}
+		}
+	}
+
+	if p.config.BreachedDir != "" {
+		breached, err := p.breached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return Violation{"has appeared in a data breach, choose a different password"}
+		}
+	}
+
+	return nil
+}
+
+// personalWords splits a detail like a name or email into the words worth
+// checking; short fragments would reject too many good passwords.
+func personalWords(detail string) []string {
+	detail = strings.ToLower(detail)
+
+	words := strings.FieldsFunc(detail, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	if local, _, ok := strings.Cut(detail, "@"); ok {
+		words = append(words, local)
+	}
+
+	kept := words[:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) >= 4 {
+			kept = append(kept, word)
+		}
+	}
+
+	return kept
+}
+
+func (p *Policy) breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(p.config.BreachedDir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,188 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from RFC 6238 appendix B, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1. The RFC's codes have 8 digits; ours are
+	// their last 6.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseSecret(t *testing.T) {
+	got, err := Code(strings.ToLower(rfcSecret), Step(time.Unix(59, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "287082" {
+		t.Errorf("Code = %s, want 287082", got)
+	}
+}
+
+func TestCodeRejectsInvalidSecret(t *testing.T) {
+	_, err := Code("not base32!", 1)
+	if err == nil {
+		t.Fatal("Code accepted a secret that isn't base32")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		secret   string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", codeAt(current), rfcSecret, current, true},
+		{"one step behind", codeAt(current - 1), rfcSecret, current - 1, true},
+		{"one step ahead", codeAt(current + 1), rfcSecret, current + 1, true},
+		{"two steps behind", codeAt(current - 2), rfcSecret, 0, false},
+		{"two steps ahead", codeAt(current + 2), rfcSecret, 0, false},
+		{"wrong code", "000000", rfcSecret, 0, false},
+		{"empty code", "", rfcSecret, 0, false},
+		{"code with a prefix", "1" + codeAt(current), rfcSecret, 0, false},
+		{"invalid secret", codeAt(current), "not base32!", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.code, tt.secret, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate = %d, %t, want %d, %t", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestValidateReportsStepForReplayChecks shows what callers rely on to refuse
+// a replayed code: the same code keeps matching the same step for as long as
+// it stays inside the window, and a later code always matches a later step.
+func TestValidateReportsStepForReplayChecks(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+
+	code, err := Code(rfcSecret, Step(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := Validate(code, rfcSecret, issued)
+	if !ok {
+		t.Fatal("code rejected when it was issued")
+	}
+
+	// Replayed a period later, the code still falls inside the skew window.
+	replayed, ok := Validate(code, rfcSecret, issued.Add(Period))
+	if !ok {
+		t.Fatal("code rejected one period later")
+	}
+	if replayed != first {
+		t.Fatalf("replayed code matched step %d, want %d", replayed, first)
+	}
+
+	next, err := Code(rfcSecret, Step(issued)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(next, rfcSecret, issued.Add(Period))
+	if !ok || step <= first {
+		t.Fatalf("next code matched step %d, %t, want a step after %d", step, ok, first)
+	}
+
+	// Past the window the code is refused outright.
+	if _, ok := Validate(code, rfcSecret, issued.Add(time.Duration(Skew+1)*Period)); ok {
+		t.Fatal("code accepted after the skew window")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not unpadded base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("key is %d bytes, want 20", len(key))
+	}
+
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == secret {
+		t.Error("two secrets were the same")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Paperback", "alice@example.com", rfcSecret)
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Fatalf("uri = %q, want an otpauth://totp URI", uri)
+	}
+	if u.Path != "/Paperback:alice@example.com" {
+		t.Errorf("label = %q, want /Paperback:alice@example.com", u.Path)
+	}
+
+	want := map[string]string{
+		"secret":    rfcSecret,
+		"issuer":    "Paperback",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
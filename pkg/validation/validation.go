@@ -6,7 +6,12 @@ import (
 )
 
 var (
-	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	EmailRX        = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	TOTPCodeRX     = regexp.MustCompile(`^[0-9]{6}$`)
+	RecoveryCodeRX = regexp.MustCompile(`^[A-Z2-7]{5}-[A-Z2-7]{5}$`)
+	// IranianMobileRX matches a mobile number in its national 09xxxxxxxxx
+	// form.
+	IranianMobileRX = regexp.MustCompile(`^09[0-9]{9}$`)
 )
 
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {